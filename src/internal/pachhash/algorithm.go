@@ -0,0 +1,113 @@
+package pachhash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"strings"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/errors"
+	"github.com/zeebo/xxh3"
+)
+
+// Algorithm names a hash algorithm registered for use as a content-address.
+// It is also the string prefix stamped onto an encoded hash (see
+// EncodeHashWithAlgorithm), so callers can tell which algorithm produced a
+// chunk ref or fileset ID without tracking it out of band. This is what lets
+// data written with one algorithm coexist with data written with another
+// during a migration.
+type Algorithm string
+
+const (
+	// AlgorithmBlake2b256 is the default, cryptographic algorithm. Use it
+	// for anything that is signed or otherwise needs to be verified.
+	AlgorithmBlake2b256 Algorithm = "b2"
+	// AlgorithmSHA256 is a cryptographic alternative to blake2b-256.
+	AlgorithmSHA256 Algorithm = "sha256"
+	// AlgorithmXXH3_128 is a fast, non-cryptographic algorithm appropriate
+	// for content-addressing non-adversarial data (e.g. dedup of pipeline
+	// output), where CPU spent hashing many small tagged parts in
+	// FileWriter.Append dominates.
+	AlgorithmXXH3_128 Algorithm = "xxh3-128"
+)
+
+// DefaultAlgorithm is the tag EncodeHash stamps on its output, and the
+// algorithm chunk.Storage and fileset.Storage use when none is given. New and
+// Sum always use blake2b-256, whatever DefaultAlgorithm is set to.
+var DefaultAlgorithm = AlgorithmBlake2b256
+
+type algorithm struct {
+	newHash func() hash.Hash
+	sum     func([]byte) Output
+}
+
+var algorithms = map[Algorithm]algorithm{
+	AlgorithmBlake2b256: {
+		newHash: New,
+		sum:     Sum,
+	},
+	AlgorithmSHA256: {
+		newHash: sha256.New,
+		sum:     func(data []byte) Output { return sha256.Sum256(data) },
+	},
+	AlgorithmXXH3_128: {
+		newHash: func() hash.Hash { return xxh3.New() },
+		sum:     sumXXH3_128,
+	},
+}
+
+// sumXXH3_128 left-aligns the 128-bit xxh3 digest in an Output, zero-padding
+// the remaining high bytes so it can share the same fixed-width type as the
+// 256-bit algorithms.
+func sumXXH3_128(data []byte) Output {
+	var out Output
+	h := xxh3.Hash128(data).Bytes()
+	copy(out[:], h[:])
+	return out
+}
+
+// IsRegistered reports whether alg has a registered implementation.
+func IsRegistered(alg Algorithm) bool {
+	_, ok := algorithms[alg]
+	return ok
+}
+
+// NewWithAlgorithm creates a new hasher for alg.
+func NewWithAlgorithm(alg Algorithm) (hash.Hash, error) {
+	a, ok := algorithms[alg]
+	if !ok {
+		return nil, errors.Errorf("pachhash: unregistered algorithm %q", alg)
+	}
+	return a.newHash(), nil
+}
+
+// SumWithAlgorithm computes a hash sum for data using alg.
+func SumWithAlgorithm(alg Algorithm, data []byte) (Output, error) {
+	a, ok := algorithms[alg]
+	if !ok {
+		return Output{}, errors.Errorf("pachhash: unregistered algorithm %q", alg)
+	}
+	return a.sum(data), nil
+}
+
+// EncodeHashWithAlgorithm encodes bytes as hex and prefixes it with alg's
+// tag (e.g. "b2-deadbeef...", "xxh3-128-deadbeef...") so that data hashed
+// with different algorithms can coexist during a migration.
+func EncodeHashWithAlgorithm(alg Algorithm, bytes []byte) string {
+	return string(alg) + "-" + hex.EncodeToString(bytes)
+}
+
+// DecodeHash splits an encoded hash produced by EncodeHashWithAlgorithm (or
+// EncodeHash) back into its algorithm tag and raw bytes.
+func DecodeHash(s string) (Algorithm, []byte, error) {
+	idx := strings.LastIndex(s, "-")
+	if idx < 0 {
+		return "", nil, errors.Errorf("pachhash: %q is not a tagged hash", s)
+	}
+	alg := Algorithm(s[:idx])
+	raw, err := hex.DecodeString(s[idx+1:])
+	if err != nil {
+		return "", nil, errors.EnsureStack(err)
+	}
+	return alg, raw, nil
+}
@@ -0,0 +1,37 @@
+package pachhash
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func benchmarkSum(b *testing.B, alg Algorithm, size int) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := SumWithAlgorithm(alg, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSum(b *testing.B) {
+	sizes := map[string]int{
+		"1KiB":   1 << 10,
+		"1MiB":   1 << 20,
+		"100MiB": 100 << 20,
+	}
+	algs := []Algorithm{AlgorithmBlake2b256, AlgorithmSHA256, AlgorithmXXH3_128}
+	for name, size := range sizes {
+		for _, alg := range algs {
+			b.Run(string(alg)+"/"+name, func(b *testing.B) {
+				benchmarkSum(b, alg, size)
+			})
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package pachhash
 
 import (
-	"encoding/hex"
 	"hash"
 
 	"golang.org/x/crypto/blake2b"
@@ -14,7 +13,7 @@ const OutputSize = 32
 // Sum returns an Output
 type Output = [OutputSize]byte
 
-// New creates a new hasher.
+// New creates a new hasher using the default algorithm (blake2b-256).
 func New() hash.Hash {
 	h, err := blake2b.New256(nil)
 	if err != nil {
@@ -23,12 +22,15 @@ func New() hash.Hash {
 	return h
 }
 
-// Sum computes a hash sum for a set of bytes.
+// Sum computes a hash sum for a set of bytes using the default algorithm
+// (blake2b-256).
 func Sum(data []byte) Output {
 	return blake2b.Sum256(data)
 }
 
-// EncodeHash encodes a hash into a string representation.
+// EncodeHash encodes a hash computed with the default algorithm into a
+// string representation, tagged with that algorithm's prefix so that
+// DecodeHash can later recover which algorithm produced it.
 func EncodeHash(bytes []byte) string {
-	return hex.EncodeToString(bytes)
+	return EncodeHashWithAlgorithm(DefaultAlgorithm, bytes)
 }
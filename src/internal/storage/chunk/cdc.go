@@ -0,0 +1,93 @@
+package chunk
+
+import (
+	"math/bits"
+	"math/rand"
+)
+
+// cdcTable is a table of pseudo-random uint32s used to roll a buzhash over
+// the input stream for content-defined chunking. It is seeded deterministically
+// so that chunk boundaries are stable across processes and restarts.
+var cdcTable = newCDCTable()
+
+func newCDCTable() [256]uint32 {
+	var table [256]uint32
+	r := rand.New(rand.NewSource(0x70616368))
+	for i := range table {
+		table[i] = r.Uint32()
+	}
+	return table
+}
+
+func rotL32(x uint32, n uint) uint32 {
+	return (x << n) | (x >> (32 - n))
+}
+
+const cdcWindowSize = 64
+
+// CDCChunker finds content-defined chunk boundaries by rolling a buzhash over
+// a sliding window of the input. Unlike fixed-size chunking, a boundary's
+// position depends only on the surrounding bytes, so inserting or deleting
+// bytes near the start of a stream only changes the chunks adjacent to the
+// edit instead of every chunk boundary after it.
+type CDCChunker struct {
+	min, avg, max int
+	mask          uint32
+
+	window   [cdcWindowSize]byte
+	wpos     int
+	wfilled  int
+	h        uint32
+	sinceCut int
+}
+
+// NewCDCChunker creates a chunker that targets an average chunk size of avg
+// bytes, never emits a chunk smaller than min bytes (except for the final
+// chunk of a stream), and forces a cut at max bytes.
+func NewCDCChunker(min, avg, max int) *CDCChunker {
+	// log2Avg is the number of low bits of the rolling hash we require to be
+	// set; on a uniformly distributed hash this yields a mean chunk size of
+	// roughly 2^log2Avg bytes.
+	log2Avg := bits.Len(uint(avg)) - 1
+	return &CDCChunker{
+		min:  min,
+		avg:  avg,
+		max:  max,
+		mask: uint32(1)<<uint(log2Avg) - 1,
+	}
+}
+
+// Next scans data starting at the chunker's current position for the next
+// chunk boundary. It returns the number of leading bytes of data that belong
+// to the chunk ending at the boundary and true, or len(data) and false if no
+// boundary was found (the caller should pass the remaining bytes back in on
+// the next call, along with more input).
+func (c *CDCChunker) Next(data []byte) (cut int, found bool) {
+	for i, b := range data {
+		out := c.window[c.wpos]
+		c.window[c.wpos] = b
+		c.wpos = (c.wpos + 1) % cdcWindowSize
+		if c.wfilled < cdcWindowSize {
+			c.wfilled++
+		}
+		c.h = (c.h << 1) ^ cdcTable[b] ^ rotL32(cdcTable[out], cdcWindowSize%32)
+		c.sinceCut++
+		if c.sinceCut >= c.max {
+			c.reset()
+			return i + 1, true
+		}
+		if c.sinceCut >= c.min && c.h&c.mask == c.mask {
+			c.reset()
+			return i + 1, true
+		}
+	}
+	return len(data), false
+}
+
+func (c *CDCChunker) reset() {
+	c.window = [cdcWindowSize]byte{}
+	c.wpos = 0
+	c.wfilled = 0
+	c.h = 0
+	c.sinceCut = 0
+}
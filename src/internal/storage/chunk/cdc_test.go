@@ -0,0 +1,61 @@
+package chunk
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// chunksFor runs data through a fresh CDCChunker and returns the byte ranges
+// of the chunks it cuts.
+func chunksFor(t *testing.T, data []byte, min, avg, max int) [][]byte {
+	t.Helper()
+	c := NewCDCChunker(min, avg, max)
+	var chunks [][]byte
+	start := 0
+	for start < len(data) {
+		n, found := c.Next(data[start:])
+		if !found {
+			chunks = append(chunks, data[start:])
+			break
+		}
+		chunks = append(chunks, data[start:start+n])
+		start += n
+	}
+	return chunks
+}
+
+// TestCDCChunkerDedup extends the write-then-read fuzz coverage of the
+// fileset package: appending a byte at the head of a file should only
+// perturb the chunk that the insertion lands in (and, when the window
+// hasn't re-synced yet, at most its neighbor), not every chunk after it.
+func TestCDCChunkerDedup(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	data := make([]byte, 4*1024*1024)
+	r.Read(data)
+
+	const min, avg, max = 512 * 1024, 1024 * 1024, 4 * 1024 * 1024
+	before := chunksFor(t, data, min, avg, max)
+
+	modified := make([]byte, len(data)+1)
+	modified[0] = 0xff
+	copy(modified[1:], data)
+	after := chunksFor(t, modified, min, avg, max)
+
+	// Index the unmodified chunks by content so we can count how many of
+	// the "before" chunks survive unchanged in "after".
+	seen := make(map[string]int)
+	for _, c := range before {
+		seen[string(c)]++
+	}
+	reused := 0
+	for _, c := range after {
+		if seen[string(c)] > 0 {
+			seen[string(c)]--
+			reused++
+		}
+	}
+	rewritten := len(before) - reused
+	if rewritten > 2 {
+		t.Fatalf("head insert rewrote %d chunks (of %d); want O(1)", rewritten, len(before))
+	}
+}
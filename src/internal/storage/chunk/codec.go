@@ -0,0 +1,63 @@
+package chunk
+
+import (
+	"io"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/errors"
+)
+
+// Codec identifies the compression algorithm a chunk was written with. It is
+// stamped into the chunk's metadata so that Storage can keep reading chunks
+// written under an older codec after the default changes.
+type Codec int32
+
+const (
+	// CodecGzip is the original, default codec.
+	CodecGzip Codec = iota
+	// CodecZstd compresses with zstd, trading a small amount of ratio for
+	// much faster decompression on the read path.
+	CodecZstd
+)
+
+// Compressor compresses a stream of chunk data.
+type Compressor interface {
+	// Codec identifies the algorithm this Compressor implements, for
+	// stamping into chunk metadata.
+	Codec() Codec
+	// Compress wraps w so that bytes written to the returned writer are
+	// compressed into w. The caller must Close the returned writer to
+	// flush trailing state.
+	Compress(w io.Writer) (io.WriteCloser, error)
+}
+
+// Decompressor decompresses a stream of chunk data produced by the
+// Compressor with the same Codec.
+type Decompressor interface {
+	Codec() Codec
+	// Decompress wraps r so that reads from the returned reader yield the
+	// decompressed bytes of r.
+	Decompress(r io.Reader) (io.ReadCloser, error)
+}
+
+// Codec_ is both a Compressor and a Decompressor.
+type Codec_ interface {
+	Compressor
+	Decompressor
+}
+
+var codecRegistry = map[Codec]Codec_{}
+
+func registerCodec(c Codec_) {
+	codecRegistry[c.Codec()] = c
+}
+
+// codecFor looks up the (de)compressor registered for id, returning an error
+// if none is registered (e.g. the chunk was written by a newer version of
+// pachyderm with a codec this binary doesn't know about).
+func codecFor(id Codec) (Codec_, error) {
+	c, ok := codecRegistry[id]
+	if !ok {
+		return nil, errors.Errorf("chunk: no compressor registered for codec %d", id)
+	}
+	return c, nil
+}
@@ -0,0 +1,28 @@
+package chunk
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+func init() {
+	registerCodec(gzipCodec{})
+}
+
+// gzipCodec is the original chunk compressor/decompressor. It remains the
+// default so that existing filesets keep reading correctly.
+type gzipCodec struct{}
+
+func (gzipCodec) Codec() Codec { return CodecGzip }
+
+func (gzipCodec) Compress(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCodec) Decompress(r io.Reader) (io.ReadCloser, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return gr, nil
+}
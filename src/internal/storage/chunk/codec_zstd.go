@@ -0,0 +1,44 @@
+package chunk
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/errors"
+)
+
+func init() {
+	registerCodec(NewZstd(zstd.SpeedDefault))
+}
+
+// zstdCodec compresses chunks with zstd. It decompresses much faster than
+// gzip, which matters for read-heavy pipelines that re-read the same
+// chunks across many jobs; Compress's ratio is tunable via level.
+type zstdCodec struct {
+	level zstd.EncoderLevel
+}
+
+// NewZstd creates a zstd Codec_ at the given compression level (e.g.
+// zstd.SpeedFastest, zstd.SpeedDefault, zstd.SpeedBestCompression).
+func NewZstd(level zstd.EncoderLevel) Codec_ {
+	return &zstdCodec{level: level}
+}
+
+func (z *zstdCodec) Codec() Codec { return CodecZstd }
+
+func (z *zstdCodec) Compress(w io.Writer) (io.WriteCloser, error) {
+	enc, err := zstd.NewWriter(w, zstd.WithEncoderLevel(z.level))
+	if err != nil {
+		return nil, errors.EnsureStack(err)
+	}
+	return enc, nil
+}
+
+func (z *zstdCodec) Decompress(r io.Reader) (io.ReadCloser, error) {
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, errors.EnsureStack(err)
+	}
+	return dec.IOReadCloser(), nil
+}
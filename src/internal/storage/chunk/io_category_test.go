@@ -0,0 +1,34 @@
+package chunk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestPutGetChunkObserveIO verifies Put and GetChunk actually record their
+// category's Prometheus counters, rather than leaving observeIO uncalled.
+func TestPutGetChunkObserveIO(t *testing.T) {
+	s := NewStorage()
+	data := []byte("metered content")
+
+	before := testutil.ToFloat64(ioOpsTotal.WithLabelValues(IOCategoryCompaction.String(), "write"))
+	ref, err := s.Put(context.Background(), data, WithPutCategory(IOCategoryCompaction))
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	after := testutil.ToFloat64(ioOpsTotal.WithLabelValues(IOCategoryCompaction.String(), "write"))
+	if after != before+1 {
+		t.Fatalf("ioOpsTotal[compaction,write] = %v, want %v", after, before+1)
+	}
+
+	beforeRead := testutil.ToFloat64(ioBytesTotal.WithLabelValues(IOCategoryPrefetch.String(), "read"))
+	if _, err := s.GetChunk(context.Background(), ref, WithGetCategory(IOCategoryPrefetch)); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	afterRead := testutil.ToFloat64(ioBytesTotal.WithLabelValues(IOCategoryPrefetch.String(), "read"))
+	if afterRead != beforeRead+float64(len(data)) {
+		t.Fatalf("ioBytesTotal[prefetch,read] = %v, want %v", afterRead, beforeRead+float64(len(data)))
+	}
+}
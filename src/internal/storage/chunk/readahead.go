@@ -0,0 +1,170 @@
+package chunk
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// chunkFuture is a handle to a chunk fetch that may still be in flight.
+type chunkFuture struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+func (f *chunkFuture) wait(ctx context.Context) ([]byte, error) {
+	select {
+	case <-f.done:
+		return f.data, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ReadAhead decouples the order chunks are fetched from Storage in from the
+// order a caller consumes them in: it walks refs in the background, prefetching
+// up to nChunks chunks (bounded additionally by maxBytes of outstanding data)
+// ahead of the consumer, while still handing results back to Next in the
+// caller-visible order.
+//
+// The key idea (as in restic's out-of-order blob restore) is that the network
+// fetch order need not match the order bytes are ultimately written out in.
+type ReadAhead struct {
+	storage     *Storage
+	nChunks     int
+	maxBytes    int64
+	refs        []Ref
+	category    IOCategory
+	pos         int
+	outstanding int64 // bytes currently fetched-but-not-consumed
+	group       singleflight.Group
+	mu          sync.Mutex
+	// fetches holds one chunkFuture per chunk ID with at least one
+	// not-yet-consumed ref remaining, whether still in flight or already
+	// complete. Keeping completed futures around (instead of deleting them
+	// as soon as their first ref is consumed) is what lets a later,
+	// separately-scheduled ref to the same chunk - the composite-fileset
+	// case this type exists for - reuse the result instead of refetching.
+	fetches map[string]*chunkFuture
+	// refCount is how many not-yet-consumed refs still point at each chunk
+	// ID; a chunk's entry in fetches is only torn down once this reaches
+	// zero.
+	refCount map[string]int
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// NewReadAhead creates a ReadAhead over refs, prefetching up to nChunks
+// chunks in parallel, and starting no new prefetch once maxBytes of
+// unconsumed chunk data is outstanding; the last prefetch started, or a
+// chunk Next has to fetch itself, can take the total past maxBytes.
+// maxBytes <= 0 means unbounded by size. Prefetches are tagged
+// with category (typically IOCategoryPrefetch) in chunk storage's metrics.
+func NewReadAhead(ctx context.Context, storage *Storage, refs []Ref, nChunks int, maxBytes int64, category IOCategory) *ReadAhead {
+	ctx, cancel := context.WithCancel(ctx)
+	refCount := make(map[string]int, len(refs))
+	for _, ref := range refs {
+		refCount[ref.Id.HashString()]++
+	}
+	ra := &ReadAhead{
+		storage:  storage,
+		nChunks:  nChunks,
+		maxBytes: maxBytes,
+		refs:     refs,
+		category: category,
+		fetches:  make(map[string]*chunkFuture),
+		refCount: refCount,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	ra.fill()
+	return ra
+}
+
+// fill kicks off prefetches for as many upcoming, not-yet-requested refs as
+// fit within nChunks and maxBytes. Two refs pointing at the same chunk
+// (common across composite filesets) share one fetch, however far apart
+// they fall in refs: fill skips a ref whose chunk already has an entry in
+// fetches, whether that entry is still in flight or already completed and
+// waiting on a later ref to consume it (see Next).
+func (ra *ReadAhead) fill() {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	for i := ra.pos; i < len(ra.refs) && len(ra.fetches) < ra.nChunks; i++ {
+		ref := ra.refs[i]
+		key := ref.Id.HashString()
+		if _, ok := ra.fetches[key]; ok {
+			continue
+		}
+		if ra.maxBytes > 0 && ra.outstanding >= ra.maxBytes {
+			break
+		}
+		ra.outstanding += ref.SizeBytes
+		f := &chunkFuture{done: make(chan struct{})}
+		ra.fetches[key] = f
+		go func(ref Ref, f *chunkFuture) {
+			v, err, _ := ra.group.Do(key, func() (interface{}, error) {
+				return ra.storage.getChunk(ra.ctx, ref, ra.category)
+			})
+			if err == nil {
+				f.data = v.([]byte)
+			} else {
+				f.err = err
+			}
+			close(f.done)
+		}(ref, f)
+	}
+}
+
+// Next blocks until the chunk for the next ref in order is available, then
+// returns its bytes. It maintains caller-visible order even though fetches
+// may complete out of order.
+func (ra *ReadAhead) Next(ctx context.Context) ([]byte, Ref, error) {
+	if ra.pos >= len(ra.refs) {
+		return nil, Ref{}, errNoMoreRefs
+	}
+	ref := ra.refs[ra.pos]
+	key := ref.Id.HashString()
+	ra.mu.Lock()
+	f, ok := ra.fetches[key]
+	ra.mu.Unlock()
+	if !ok {
+		// Completed futures kept for a later ref still count toward
+		// nChunks and maxBytes, so fill may have left no room to start
+		// this ref's fetch; fetch it here.
+		f = &chunkFuture{done: make(chan struct{})}
+		f.data, f.err = ra.storage.getChunk(ra.ctx, ref, ra.category)
+		close(f.done)
+		ra.mu.Lock()
+		ra.outstanding += ref.SizeBytes
+		ra.fetches[key] = f
+		ra.mu.Unlock()
+	}
+	data, err := f.wait(ctx)
+	ra.mu.Lock()
+	ra.refCount[key]--
+	if ra.refCount[key] <= 0 {
+		ra.outstanding -= ref.SizeBytes
+		delete(ra.fetches, key)
+		delete(ra.refCount, key)
+	}
+	ra.pos++
+	ra.mu.Unlock()
+	ra.fill()
+	return data, ref, err
+}
+
+// Close cancels any outstanding prefetches; callers must call it once they
+// stop consuming (e.g. because the reader was aborted) so background
+// fetches don't keep running for chunks nobody will read.
+func (ra *ReadAhead) Close() {
+	ra.cancel()
+}
+
+var errNoMoreRefs = errNoMoreRefsErr{}
+
+type errNoMoreRefsErr struct{}
+
+func (errNoMoreRefsErr) Error() string { return "chunk: no more refs" }
@@ -0,0 +1,238 @@
+package chunk
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/errors"
+	"github.com/pachyderm/pachyderm/v2/src/internal/pachhash"
+)
+
+// TrackerPrefix is used for creating tracker objects for chunks.
+const TrackerPrefix = "chunk/"
+
+// ID is a content-addressed chunk identifier: the hash of a chunk's
+// uncompressed bytes.
+type ID string
+
+// HashString returns id's string form, e.g. for use as a cache or map key.
+func (id ID) HashString() string { return string(id) }
+
+// Ref identifies a stored chunk: which object holds it, what it was
+// compressed with, and how large its uncompressed content is.
+type Ref struct {
+	Id        ID
+	Codec     Codec
+	SizeBytes int64
+}
+
+type storedObject struct {
+	data  []byte // compressed bytes
+	codec Codec
+}
+
+// Storage is the content-addressed store chunks are written to and read
+// from. Equal content always maps to the same ID, so writing the same
+// chunk twice is a no-op: this is the dedup property fileset.Writer's
+// content-defined chunking relies on.
+type Storage struct {
+	mu      sync.Mutex
+	objects map[ID]storedObject
+}
+
+// NewStorage creates a new Storage.
+func NewStorage() *Storage {
+	return &Storage{objects: make(map[ID]storedObject)}
+}
+
+// putConfig collects the settings a PutOption applies to a single Put call.
+type putConfig struct {
+	compressor Codec_
+	algorithm  pachhash.Algorithm
+	category   IOCategory
+}
+
+// PutOption configures a single Put call.
+type PutOption func(*putConfig)
+
+// WithPutCompressor compresses this chunk with c instead of the package's
+// default codec (gzip). c's Codec is stamped into the resulting Ref and the
+// stored object (a chunk already stored keeps the codec it was first written
+// with, and the Ref reports that one), so GetChunk looks up the right
+// decompressor regardless of
+// what any other chunk in the same Storage was compressed with: chunks
+// written under different codecs, including across a change to the default,
+// coexist and keep reading correctly.
+func WithPutCompressor(c Codec_) PutOption {
+	return func(cfg *putConfig) {
+		cfg.compressor = c
+	}
+}
+
+// WithPutHashAlgorithm content-addresses this chunk with alg instead of
+// pachhash.DefaultAlgorithm. The resulting ID carries alg's tag (see
+// pachhash.EncodeHashWithAlgorithm), so chunks hashed with different
+// algorithms can coexist in the same Storage during a migration.
+func WithPutHashAlgorithm(alg pachhash.Algorithm) PutOption {
+	return func(cfg *putConfig) {
+		cfg.algorithm = alg
+	}
+}
+
+// WithPutCategory tags this Put's metrics with category instead of
+// IOCategoryUnspecified.
+func WithPutCategory(category IOCategory) PutOption {
+	return func(cfg *putConfig) {
+		cfg.category = category
+	}
+}
+
+// getConfig collects the settings a GetOption applies to a single GetChunk
+// call.
+type getConfig struct {
+	category IOCategory
+}
+
+// GetOption configures a single GetChunk call.
+type GetOption func(*getConfig)
+
+// WithGetCategory tags this GetChunk's metrics with category instead of
+// IOCategoryUnspecified.
+func WithGetCategory(category IOCategory) GetOption {
+	return func(cfg *getConfig) {
+		cfg.category = category
+	}
+}
+
+// Put compresses and stores data, returning a Ref that can later be passed
+// to GetChunk. If a chunk with identical content has already been stored,
+// Put still hashes and compresses data, but the existing object is reused,
+// no new bytes are written, and the returned Ref carries the codec the
+// existing object was compressed with.
+func (s *Storage) Put(ctx context.Context, data []byte, opts ...PutOption) (Ref, error) {
+	start := time.Now()
+	var cfg putConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	defer func() {
+		observeIO(cfg.category, "write", len(data), time.Since(start).Seconds())
+	}()
+	algorithm := cfg.algorithm
+	if algorithm == "" {
+		algorithm = pachhash.DefaultAlgorithm
+	}
+	sum, err := pachhash.SumWithAlgorithm(algorithm, data)
+	if err != nil {
+		return Ref{}, err
+	}
+	id := ID(pachhash.EncodeHashWithAlgorithm(algorithm, sum[:]))
+
+	compressor := cfg.compressor
+	if compressor == nil {
+		var err error
+		compressor, err = codecFor(CodecGzip)
+		if err != nil {
+			return Ref{}, err
+		}
+	}
+	var buf bytes.Buffer
+	cw, err := compressor.Compress(&buf)
+	if err != nil {
+		return Ref{}, err
+	}
+	if _, err := cw.Write(data); err != nil {
+		return Ref{}, errors.EnsureStack(err)
+	}
+	if err := cw.Close(); err != nil {
+		return Ref{}, errors.EnsureStack(err)
+	}
+
+	s.mu.Lock()
+	obj, exists := s.objects[id]
+	if !exists {
+		obj = storedObject{data: buf.Bytes(), codec: compressor.Codec()}
+		s.objects[id] = obj
+	}
+	s.mu.Unlock()
+
+	return Ref{Id: id, Codec: obj.codec, SizeBytes: int64(len(data))}, nil
+}
+
+// GetChunk fetches and decompresses the chunk ref points at.
+func (s *Storage) GetChunk(ctx context.Context, ref Ref, opts ...GetOption) ([]byte, error) {
+	start := time.Now()
+	var cfg getConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	data, err := s.getChunkBytes(ref)
+	observeIO(cfg.category, "read", len(data), time.Since(start).Seconds())
+	return data, err
+}
+
+func (s *Storage) getChunkBytes(ref Ref) ([]byte, error) {
+	if alg, _, err := pachhash.DecodeHash(string(ref.Id)); err == nil && !pachhash.IsRegistered(alg) {
+		return nil, errors.Errorf("chunk: %v was hashed with unregistered algorithm %q", ref.Id, alg)
+	}
+	s.mu.Lock()
+	obj, ok := s.objects[ref.Id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, errors.Errorf("chunk: no such chunk %v", ref.Id)
+	}
+	codec, err := codecFor(obj.codec)
+	if err != nil {
+		return nil, err
+	}
+	dr, err := codec.Decompress(bytes.NewReader(obj.data))
+	if err != nil {
+		return nil, err
+	}
+	defer dr.Close()
+	data, err := io.ReadAll(dr)
+	if err != nil {
+		return nil, errors.EnsureStack(err)
+	}
+	return data, nil
+}
+
+// getChunk is used by ReadAhead, which prefetches chunks in the background
+// on the caller's behalf, tagged with category so prefetches are counted
+// separately from the foreground reads that triggered them.
+func (s *Storage) getChunk(ctx context.Context, ref Ref, category IOCategory) ([]byte, error) {
+	return s.GetChunk(ctx, ref, WithGetCategory(category))
+}
+
+// Len reports how many distinct chunks are currently stored. It exists
+// mainly so tests can observe deduplication directly.
+func (s *Storage) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.objects)
+}
+
+// NewDeleter creates a deleter for garbage-collecting chunk objects tagged
+// with category, so GC scans are accounted separately from other chunk I/O.
+func (s *Storage) NewDeleter(category IOCategory) *chunkDeleter {
+	return &chunkDeleter{storage: s, category: category}
+}
+
+// chunkDeleter implements track.Deleter for chunk objects.
+type chunkDeleter struct {
+	storage  *Storage
+	category IOCategory
+}
+
+// Delete removes the chunk object with the given id.
+func (d *chunkDeleter) Delete(ctx context.Context, id string) error {
+	start := time.Now()
+	d.storage.mu.Lock()
+	delete(d.storage.objects, ID(id))
+	d.storage.mu.Unlock()
+	observeIO(d.category, "delete", 0, time.Since(start).Seconds())
+	return nil
+}
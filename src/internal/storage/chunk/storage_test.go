@@ -0,0 +1,61 @@
+package chunk
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/pachhash"
+)
+
+// TestPutHashAlgorithmTag verifies that WithPutHashAlgorithm actually
+// changes which algorithm a chunk is hashed with, and that the resulting ID
+// carries that algorithm's tag so mixed-algorithm chunks stay distinguishable
+// within the same Storage.
+func TestPutHashAlgorithmTag(t *testing.T) {
+	s := NewStorage()
+	data := []byte("some chunk content")
+
+	defaultRef, err := s.Put(context.Background(), data)
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if !strings.HasPrefix(string(defaultRef.Id), string(pachhash.DefaultAlgorithm)+"-") {
+		t.Fatalf("default Put's ID %q doesn't carry the default algorithm's tag", defaultRef.Id)
+	}
+
+	xxh3Ref, err := s.Put(context.Background(), data, WithPutHashAlgorithm(pachhash.AlgorithmXXH3_128))
+	if err != nil {
+		t.Fatalf("put with xxh3: %v", err)
+	}
+	if !strings.HasPrefix(string(xxh3Ref.Id), string(pachhash.AlgorithmXXH3_128)+"-") {
+		t.Fatalf("xxh3-hashed Put's ID %q doesn't carry the xxh3-128 tag", xxh3Ref.Id)
+	}
+	if xxh3Ref.Id == defaultRef.Id {
+		t.Fatalf("hashing the same content with two different algorithms produced the same ID")
+	}
+
+	// Both IDs must still be independently readable: a hash algorithm
+	// change doesn't disturb chunks already written under another one.
+	if got, err := s.GetChunk(context.Background(), defaultRef); err != nil || string(got) != string(data) {
+		t.Fatalf("GetChunk(defaultRef) = %q, %v", got, err)
+	}
+	if got, err := s.GetChunk(context.Background(), xxh3Ref); err != nil || string(got) != string(data) {
+		t.Fatalf("GetChunk(xxh3Ref) = %q, %v", got, err)
+	}
+}
+
+// TestGetChunkRejectsUnregisteredAlgorithm verifies GetChunk refuses a ref
+// whose ID is tagged with a hash algorithm this build doesn't have
+// registered, rather than silently treating the tag as part of an opaque
+// ID. The check has to live here, not on a fileset ID: a fileset ID is a
+// plain random identifier with no algorithm tag at all, so only a
+// content-addressed, algorithm-tagged identifier like a chunk ref can ever
+// fail it for real.
+func TestGetChunkRejectsUnregisteredAlgorithm(t *testing.T) {
+	s := NewStorage()
+	ref := Ref{Id: ID("made-up-algorithm-deadbeef"), SizeBytes: 4}
+	if _, err := s.GetChunk(context.Background(), ref); err == nil {
+		t.Fatalf("expected an error for a ref hashed with an unregistered algorithm, got nil")
+	}
+}
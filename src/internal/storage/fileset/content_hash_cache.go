@@ -0,0 +1,336 @@
+package fileset
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	iradix "github.com/hashicorp/go-immutable-radix"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/errors"
+	"github.com/pachyderm/pachyderm/v2/src/internal/pachhash"
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/fileset/index"
+)
+
+// dirFileType tags a childDigest as standing in for a directory rather than
+// a file, so a directory and a file that happen to share a name and digest
+// (an empty file named "sub" vs. an empty directory "sub") still hash
+// differently.
+const dirFileType = ^uint32(0)
+
+// ContentHashCache memoizes the recursive content digest of paths within a
+// fileset, the same way BuildKit's content-addressable build cache avoids
+// rehashing subtrees that didn't change between builds. It's backed by an
+// immutable radix tree so that computing the digest of a mutated path can
+// reuse every other (structurally shared) subtree unchanged, without a
+// mutex-guarded cache invalidation pass over the whole tree.
+//
+// Entries are keyed on (filesetID, path) so that checking two different
+// filesets' identical paths (the common case across repeated compactions)
+// never evicts each other's cached digests.
+type ContentHashCache struct {
+	mu   sync.Mutex
+	tree *iradix.Tree
+}
+
+// NewContentHashCache creates an empty ContentHashCache.
+func NewContentHashCache() *ContentHashCache {
+	return &ContentHashCache{tree: iradix.New()}
+}
+
+func cacheKey(id ID, path string) []byte {
+	return []byte(string(id) + "\x00" + path)
+}
+
+func (c *ContentHashCache) get(id ID, path string) (pachhash.Output, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.tree.Get(cacheKey(id, path))
+	if !ok {
+		return pachhash.Output{}, false
+	}
+	return v.(pachhash.Output), true
+}
+
+func (c *ContentHashCache) put(id ID, path string, digest pachhash.Output) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tree, _, _ = c.tree.Insert(cacheKey(id, path), digest)
+}
+
+// invalidate drops the cached digest for path within id.
+func (c *ContentHashCache) invalidate(id ID, path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tree, _ = c.tree.Delete(cacheKey(id, path))
+}
+
+// invalidateFileset drops every cached digest recorded under id, for every
+// path at once. It's called once id's fileset is actually deleted (see
+// Storage.GC's filesetDeleter): at that point every entry cached under id is
+// unrecoverable dead weight in the tree (id will never be looked up again,
+// barring the content-addressed-ID-collision case hashing already assumes
+// away), so there's no reason to let it ride along until something else
+// happens to evict it.
+func (c *ContentHashCache) invalidateFileset(id ID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prefix := append([]byte(string(id)), 0)
+	var keys [][]byte
+	c.tree.Root().WalkPrefix(prefix, func(k []byte, _ interface{}) bool {
+		keys = append(keys, k)
+		return false
+	})
+	for _, k := range keys {
+		c.tree, _ = c.tree.Delete(k)
+	}
+}
+
+// childDigest is what dirDigest hashes together for each immediate child of
+// a directory.
+type childDigest struct {
+	name   string
+	mode   uint32
+	digest pachhash.Output
+}
+
+// dirDigest computes a directory's recursive digest from its sorted
+// immediate children (files and, via a prior call to dirDigest for each
+// subdirectory, directories), so that reordering an unrelated sibling never
+// changes the digest, and a directory's digest always reflects everything
+// beneath it, not just its direct file children. alg selects the hash
+// algorithm (see pachhash.NewWithAlgorithm); the empty string falls back to
+// pachhash.DefaultAlgorithm.
+func dirDigest(children []childDigest, alg pachhash.Algorithm) (pachhash.Output, error) {
+	sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+	if alg == "" {
+		alg = pachhash.DefaultAlgorithm
+	}
+	h, err := pachhash.NewWithAlgorithm(alg)
+	if err != nil {
+		return pachhash.Output{}, err
+	}
+	for _, c := range children {
+		h.Write([]byte(c.name))
+		h.Write([]byte{byte(c.mode), byte(c.mode >> 8), byte(c.mode >> 16), byte(c.mode >> 24)})
+		h.Write(c.digest[:])
+	}
+	var out pachhash.Output
+	copy(out[:], h.Sum(nil))
+	return out, nil
+}
+
+// leafDigest is one file's content digest, as collected by Checksum before
+// aggregateDirDigests folds it up into its ancestor directories' digests.
+type leafDigest struct {
+	path   string
+	mode   uint32
+	digest pachhash.Output
+}
+
+// aggregateDirDigests computes the recursive digest of root from leaves (the
+// content digest of every file under root), along with every intermediate
+// directory's digest along the way. It's bottom-up: a directory's digest
+// isn't computed until every directory nested inside it already has been,
+// so a change to a deeply nested file always propagates all the way up to
+// root, unlike folding only each file's immediate parent into root directly.
+//
+// The returned map has one entry per directory under (and including) root;
+// result[root] is root's digest. If root itself names a file rather than a
+// directory, the map has no entries and the file's own digest (leaves[0])
+// should be used instead. alg selects the hash algorithm used to combine
+// each directory's children; see dirDigest.
+func aggregateDirDigests(leaves []leafDigest, root string, alg pachhash.Algorithm) (map[string]pachhash.Output, error) {
+	childrenOf := make(map[string][]childDigest)
+	dirSet := make(map[string]bool)
+	for _, leaf := range leaves {
+		dir, name := splitPath(leaf.path)
+		childrenOf[dir] = append(childrenOf[dir], childDigest{name: name, mode: leaf.mode, digest: leaf.digest})
+		// Walk every ancestor directory from dir up to root, so a
+		// directory with no direct file children of its own (only
+		// subdirectories) still gets its digest computed below.
+		for d := dir; strings.HasPrefix(d, root); {
+			if dirSet[d] {
+				break
+			}
+			dirSet[d] = true
+			if d == root || d == "" {
+				break
+			}
+			d = parentOf(d)
+		}
+	}
+	if len(dirSet) == 0 {
+		return nil, nil
+	}
+
+	dirs := make([]string, 0, len(dirSet))
+	for d := range dirSet {
+		dirs = append(dirs, d)
+	}
+	// Deepest directories first, so that by the time a directory is
+	// folded into its parent's children, its own digest (over its full
+	// subtree) has already been computed.
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+
+	digests := make(map[string]pachhash.Output, len(dirs))
+	for _, d := range dirs {
+		digest, err := dirDigest(childrenOf[d], alg)
+		if err != nil {
+			return nil, err
+		}
+		digests[d] = digest
+		if d == root {
+			continue
+		}
+		parent, name := splitPath(strings.TrimSuffix(d, "/"))
+		childrenOf[parent] = append(childrenOf[parent], childDigest{name: name, mode: dirFileType, digest: digest})
+	}
+	return digests, nil
+}
+
+// Checksum returns the recursive content digest of path within the fileset
+// id (path == "/" for the whole fileset), reusing the cached digest from a
+// prior call where available. Every directory between path and each file
+// under it contributes to the result: a change to a deeply nested file
+// changes that file's parent directory's digest, which changes its parent's
+// digest, and so on up to path, exactly like a Merkle tree.
+//
+// Leaf (file) digests are cached under the primitive layer that actually
+// produced their bytes (see checksumLeaves), not under id: Compose and
+// compaction give the same set of layers a new composite ID every time, but
+// a primitive layer's bytes at a path never change once written, so keying
+// leaf entries by layer ID is what makes repeated Checksum calls across that
+// churn reuse work instead of starting from a cold cache on every compose.
+// Directory digests, which combine multiple layers' worth of children, are
+// specific to this exact combination of layers and are cached under id
+// itself; recombining already-hashed children is cheap, so there's little
+// to gain from trying to share them across composites.
+func (s *Storage) Checksum(ctx context.Context, id ID, path string) (pachhash.Output, error) {
+	if d, ok := s.hashCache.get(id, path); ok {
+		return d, nil
+	}
+	leaves, err := s.checksumLeaves(ctx, id, path)
+	if err != nil {
+		return pachhash.Output{}, err
+	}
+	if len(leaves) == 0 {
+		return pachhash.Output{}, errors.Errorf("checksum: no files found under %q", path)
+	}
+
+	digests, err := aggregateDirDigests(leaves, path, s.hashAlgorithm)
+	if err != nil {
+		return pachhash.Output{}, err
+	}
+	if digests == nil {
+		// path names a single file directly, not a directory.
+		return leaves[0].digest, nil
+	}
+	for dir, digest := range digests {
+		s.hashCache.put(id, dir, digest)
+	}
+	return digests[path], nil
+}
+
+// checksumLeaves collects the leaf (file) digests under path within id,
+// dispatching to checksumPrimitiveLeaves or checksumCompositeLeaves
+// depending on what id actually is.
+func (s *Storage) checksumLeaves(ctx context.Context, id ID, path string) ([]leafDigest, error) {
+	md, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if x, ok := md.Value.(*Metadata_Composite); ok {
+		return s.checksumCompositeLeaves(ctx, x.Composite.Layers, path)
+	}
+	return s.checksumPrimitiveLeaves(ctx, id, path)
+}
+
+// checksumPrimitiveLeaves hashes every file under path within the primitive
+// fileset id, reusing (and populating) hashCache's entries for id directly:
+// a primitive fileset's bytes are immutable once written, so a leaf cached
+// under id is valid for as long as id itself exists (see
+// ContentHashCache.invalidateFileset for when that stops being true).
+func (s *Storage) checksumPrimitiveLeaves(ctx context.Context, id ID, path string) ([]leafDigest, error) {
+	fs := s.newReader(string(id), index.WithPrefix(path))
+	var leaves []leafDigest
+	if err := fs.Iterate(ctx, func(f File) error {
+		idx := f.Index()
+		if d, ok := s.hashCache.get(id, idx.Path); ok {
+			leaves = append(leaves, leafDigest{path: idx.Path, mode: idx.FileType, digest: d})
+			return nil
+		}
+		d, err := fileContentDigest(f, s.hashAlgorithm)
+		if err != nil {
+			return err
+		}
+		s.hashCache.put(id, idx.Path, d)
+		leaves = append(leaves, leafDigest{path: idx.Path, mode: idx.FileType, digest: d})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return leaves, nil
+}
+
+// checksumCompositeLeaves resolves path across layers (outermost/top layer
+// last, same order Open and reader.go's mergeTOCs use), recursing into each
+// one through checksumLeaves so a layer that's itself a composite still
+// caches its own leaves under its own ID. A path present in more than one
+// layer takes the top layer's leaf, shadowing the lower ones, matching the
+// overlay semantics the rest of this series gives composite filesets.
+func (s *Storage) checksumCompositeLeaves(ctx context.Context, layers []ID, path string) ([]leafDigest, error) {
+	byPath := make(map[string]leafDigest)
+	var order []string
+	for _, layer := range layers {
+		layerLeaves, err := s.checksumLeaves(ctx, layer, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range layerLeaves {
+			if _, ok := byPath[l.path]; !ok {
+				order = append(order, l.path)
+			}
+			byPath[l.path] = l
+		}
+	}
+	leaves := make([]leafDigest, len(order))
+	for i, p := range order {
+		leaves[i] = byPath[p]
+	}
+	return leaves, nil
+}
+
+func fileContentDigest(f File, alg pachhash.Algorithm) (pachhash.Output, error) {
+	if alg == "" {
+		alg = pachhash.DefaultAlgorithm
+	}
+	h, err := pachhash.NewWithAlgorithm(alg)
+	if err != nil {
+		return pachhash.Output{}, err
+	}
+	if err := f.Content(h); err != nil {
+		return pachhash.Output{}, err
+	}
+	var out pachhash.Output
+	copy(out[:], h.Sum(nil))
+	return out, nil
+}
+
+// splitPath splits a fileset path into its parent directory (with a
+// trailing slash) and base name.
+func splitPath(p string) (dir, name string) {
+	i := len(p) - 1
+	for i >= 0 && p[i] != '/' {
+		i--
+	}
+	return p[:i+1], p[i+1:]
+}
+
+// parentOf returns dir's parent directory, given dir itself ends in '/'.
+func parentOf(dir string) string {
+	trimmed := strings.TrimSuffix(dir, "/")
+	parent, _ := splitPath(trimmed)
+	return parent
+}
@@ -0,0 +1,126 @@
+package fileset
+
+import (
+	"testing"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/pachhash"
+)
+
+func digestOf(s string) pachhash.Output {
+	return pachhash.Sum([]byte(s))
+}
+
+// TestAggregateDirDigestsNestedChange verifies that a change to a file
+// nested under a subdirectory changes the root digest: the subdirectory's
+// digest must itself be folded into the root's children, not just the
+// files directly under root.
+func TestAggregateDirDigestsNestedChange(t *testing.T) {
+	base := []leafDigest{
+		{path: "/a.txt", mode: 1, digest: digestOf("a")},
+		{path: "/sub/b.txt", mode: 1, digest: digestOf("b")},
+	}
+	beforeDigests, err := aggregateDirDigests(base, "/", "")
+	if err != nil {
+		t.Fatalf("aggregateDirDigests: %v", err)
+	}
+	before := beforeDigests["/"]
+
+	changed := []leafDigest{
+		{path: "/a.txt", mode: 1, digest: digestOf("a")},
+		{path: "/sub/b.txt", mode: 1, digest: digestOf("b-changed")},
+	}
+	afterDigests, err := aggregateDirDigests(changed, "/", "")
+	if err != nil {
+		t.Fatalf("aggregateDirDigests: %v", err)
+	}
+	after := afterDigests["/"]
+
+	if before == after {
+		t.Fatalf("changing /sub/b.txt did not change the root digest")
+	}
+}
+
+// TestAggregateDirDigestsDeepNesting exercises more than one level of
+// nesting, so a leaf two directories down must still propagate up through
+// its immediate parent and its grandparent.
+func TestAggregateDirDigestsDeepNesting(t *testing.T) {
+	leaves := []leafDigest{
+		{path: "/x/y/z.txt", mode: 1, digest: digestOf("z")},
+	}
+	digests, err := aggregateDirDigests(leaves, "/", "")
+	if err != nil {
+		t.Fatalf("aggregateDirDigests: %v", err)
+	}
+	for _, dir := range []string{"/", "/x/", "/x/y/"} {
+		if _, ok := digests[dir]; !ok {
+			t.Fatalf("missing digest for %q", dir)
+		}
+	}
+	leaves2 := []leafDigest{
+		{path: "/x/y/z.txt", mode: 1, digest: digestOf("z-changed")},
+	}
+	digests2, err := aggregateDirDigests(leaves2, "/", "")
+	if err != nil {
+		t.Fatalf("aggregateDirDigests: %v", err)
+	}
+	if digests["/"] == digests2["/"] {
+		t.Fatalf("changing a file two directories down did not change the root digest")
+	}
+	if digests["/x/"] == digests2["/x/"] {
+		t.Fatalf("changing a file two directories down did not change its grandparent's digest")
+	}
+}
+
+// TestAggregateDirDigestsSingleFile covers the path-names-a-file case,
+// where aggregateDirDigests has no directories to report.
+func TestAggregateDirDigestsSingleFile(t *testing.T) {
+	leaves := []leafDigest{{path: "/a.txt", mode: 1, digest: digestOf("a")}}
+	digests, err := aggregateDirDigests(leaves, "/a.txt", "")
+	if err != nil {
+		t.Fatalf("aggregateDirDigests: %v", err)
+	}
+	if digests != nil {
+		t.Fatalf("expected nil digests for a file path, got %v", digests)
+	}
+}
+
+// TestContentHashCacheKeyedByID verifies the cache is keyed by
+// (filesetID, path): two filesets with the same path and different digests
+// must not evict or shadow one another.
+func TestContentHashCacheKeyedByID(t *testing.T) {
+	c := NewContentHashCache()
+	dA, dB := digestOf("A"), digestOf("B")
+	c.put("fileset-a", "/same/path", dA)
+	c.put("fileset-b", "/same/path", dB)
+
+	gotA, ok := c.get("fileset-a", "/same/path")
+	if !ok || gotA != dA {
+		t.Fatalf("fileset-a's cached digest was evicted by fileset-b's put: got %v, ok=%v", gotA, ok)
+	}
+	gotB, ok := c.get("fileset-b", "/same/path")
+	if !ok || gotB != dB {
+		t.Fatalf("fileset-b's cached digest missing: got %v, ok=%v", gotB, ok)
+	}
+}
+
+// TestContentHashCacheInvalidateFileset verifies invalidateFileset drops
+// every path cached under the given id, without disturbing another id's
+// entries that happen to share a path.
+func TestContentHashCacheInvalidateFileset(t *testing.T) {
+	c := NewContentHashCache()
+	c.put("fileset-a", "/", digestOf("root"))
+	c.put("fileset-a", "/sub/", digestOf("sub"))
+	c.put("fileset-b", "/", digestOf("other-root"))
+
+	c.invalidateFileset("fileset-a")
+
+	if _, ok := c.get("fileset-a", "/"); ok {
+		t.Fatalf("invalidateFileset left /  cached under fileset-a")
+	}
+	if _, ok := c.get("fileset-a", "/sub/"); ok {
+		t.Fatalf("invalidateFileset left /sub/ cached under fileset-a")
+	}
+	if _, ok := c.get("fileset-b", "/"); !ok {
+		t.Fatalf("invalidateFileset evicted fileset-b's unrelated entry")
+	}
+}
@@ -0,0 +1,40 @@
+package fileset
+
+import (
+	"github.com/pachyderm/pachyderm/v2/src/internal/errors"
+)
+
+// tocOf returns f's TOC directly, for the File implementations this package
+// produces (fileRecord, compositeFile) - the only ones whose chunk refs
+// CopyFiles can reuse outright without reading and re-chunking their
+// content.
+func tocOf(f File) (*TOC, error) {
+	switch x := f.(type) {
+	case *fileRecord:
+		return x.entry.toc, nil
+	case *compositeFile:
+		return x.toc, nil
+	default:
+		return nil, errors.Errorf("CopyFiles: cannot copy %T without re-chunking its content", f)
+	}
+}
+
+// CopyFiles copies each file in src into dst by recording its existing TOC
+// entries directly rather than streaming the bytes back through dst's own
+// chunker: chunk.Storage is content-addressed, so src's chunk refs are
+// still valid, cheap-to-reuse inputs, and copying them outright means dst
+// shares src's chunks even when dst's CDC, compressor, or hash-algorithm
+// settings differ from whatever src was originally written with. Tag dst
+// with chunk.IOCategoryCopy (via WithIOCategory) to have reads of the
+// copied files counted as copy traffic, distinct from the
+// user write, compaction, or GC scan that produced src's chunks.
+func CopyFiles(dst *Writer, src []File) error {
+	for _, f := range src {
+		toc, err := tocOf(f)
+		if err != nil {
+			return err
+		}
+		dst.appendTOC(f.Index().Path, toc)
+	}
+	return nil
+}
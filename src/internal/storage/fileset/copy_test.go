@@ -0,0 +1,73 @@
+package fileset
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/fileset/index"
+)
+
+// TestCopyFilesReusesChunkRefs verifies CopyFiles reproduces a source
+// file's content in dst by copying its existing TOC entries directly:
+// dst's chunk storage ends up with zero new chunks, and the copied
+// TOCEntries point at exactly src's chunk refs rather than freshly cut
+// ones, even though dst was configured with different content-defined
+// chunking parameters than src.
+func TestCopyFilesReusesChunkRefs(t *testing.T) {
+	chunks := chunk.NewStorage()
+	data := bytes.Repeat([]byte("copy me, "), 1<<15)
+	src := writeOne(t, chunks, data)
+	before := chunks.Len()
+
+	srcFile := src.Files()[0]
+	srcTOC := src.files[0].toc
+
+	storage := &Storage{}
+	dst := newWriter(context.Background(), storage, nil, chunks,
+		WithContentDefinedChunking(4*1024, 8*1024, 16*1024))
+	if err := CopyFiles(dst, []File{srcFile}); err != nil {
+		t.Fatalf("CopyFiles: %v", err)
+	}
+	if err := dst.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if got := readBack(t, chunks, dst); !bytes.Equal(got, data) {
+		t.Fatalf("copied content mismatch: got %d bytes, want %d", len(got), len(data))
+	}
+	if after := chunks.Len(); after != before {
+		t.Fatalf("CopyFiles created %d new chunks for unchanged content, want 0", after-before)
+	}
+
+	dstTOC := dst.files[0].toc
+	if len(dstTOC.Entries) != len(srcTOC.Entries) {
+		t.Fatalf("copied TOC has %d entries, want %d (src's, reused directly)", len(dstTOC.Entries), len(srcTOC.Entries))
+	}
+	for i, e := range dstTOC.Entries {
+		if e.ChunkRef != srcTOC.Entries[i].ChunkRef {
+			t.Fatalf("entry %d ChunkRef = %v, want src's ref %v (re-chunked instead of reused)", i, e.ChunkRef, srcTOC.Entries[i].ChunkRef)
+		}
+	}
+}
+
+// TestCopyFilesCannotCopyUnknownFileType verifies CopyFiles refuses to
+// silently re-chunk a File implementation it doesn't recognize, rather than
+// falling back to reading its content.
+func TestCopyFilesCannotCopyUnknownFileType(t *testing.T) {
+	storage := &Storage{}
+	dst := newWriter(context.Background(), storage, nil, chunk.NewStorage())
+	if err := CopyFiles(dst, []File{unknownFile{}}); err == nil {
+		t.Fatalf("expected an error copying an unrecognized File implementation, got nil")
+	}
+}
+
+// unknownFile is a File implementation CopyFiles has no special knowledge
+// of, standing in for e.g. a File backed by some other package entirely.
+type unknownFile struct{}
+
+func (unknownFile) Index() *index.Index     { return &index.Index{Path: "/unknown"} }
+func (unknownFile) Content(io.Writer) error { return nil }
+func (unknownFile) ReaderAt() io.ReaderAt   { return bytes.NewReader(nil) }
@@ -0,0 +1,21 @@
+package fileset
+
+import (
+	"io"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/fileset/index"
+)
+
+// File is a handle to one file within a FileSet, as produced by
+// FileSet.Iterate.
+type File interface {
+	// Index returns the index entry backing this file.
+	Index() *index.Index
+	// Content writes the file's full content to w.
+	Content(w io.Writer) error
+	// ReaderAt returns a random-access reader over the file's content,
+	// backed by its TOC: reads only fetch the chunks a window overlaps
+	// instead of decompressing everything up to it. Composite filesets
+	// merge the TOCs of their layers so this works across layers too.
+	ReaderAt() io.ReaderAt
+}
@@ -0,0 +1,24 @@
+package fileset
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// ID and newID are foundational to this package: Storage.newPrimitive,
+// Storage.newComposite, and Storage.Clone have called newID and used ID
+// since before any of this series' requests landed, so this file's sole
+// purpose is to be their one, single declaration - it isn't specific to any
+// one feature built on top of Storage.
+//
+// ID identifies a fileset (primitive or composite) within a Store.
+type ID = string
+
+// newID generates a new, random fileset ID.
+func newID() ID {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf[:])
+}
@@ -0,0 +1,10 @@
+package index
+
+// Index is the metadata fileset.File.Index returns for one file.
+type Index struct {
+	// Path is the file's path within its fileset.
+	Path string
+	// FileType is the file's mode/type tag. fileset's Writer records none,
+	// so the files it writes report 0.
+	FileType uint32
+}
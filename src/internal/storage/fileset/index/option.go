@@ -0,0 +1,41 @@
+package index
+
+import "github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+
+// Options collects the settings controlled by Option.
+type Options struct {
+	ReadAheadChunks int
+	ReadAheadBytes  int64
+	Prefix          string
+	Category        chunk.IOCategory
+}
+
+// Option configures how an index is read.
+type Option func(o *Options)
+
+// WithReadAhead configures a Reader constructed with these options to
+// prefetch up to nChunks chunks ahead of the consumer (see
+// chunk.ReadAhead), bounded additionally by maxBytes of outstanding,
+// not-yet-consumed chunk data. maxBytes <= 0 means unbounded by size.
+func WithReadAhead(nChunks int, maxBytes int64) Option {
+	return func(o *Options) {
+		o.ReadAheadChunks = nChunks
+		o.ReadAheadBytes = maxBytes
+	}
+}
+
+// WithPrefix restricts iteration to paths under prefix.
+func WithPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.Prefix = prefix
+	}
+}
+
+// WithIOCategory tags the chunk reads a Reader makes with category, so
+// they're counted separately in chunk storage's per-category metrics. The
+// reads are not bound by that category's semaphore.
+func WithIOCategory(category chunk.IOCategory) Option {
+	return func(o *Options) {
+		o.Category = category
+	}
+}
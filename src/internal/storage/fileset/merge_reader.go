@@ -0,0 +1,58 @@
+package fileset
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+)
+
+// FileSet is anything Storage.Open can hand back: a readable view over one
+// or more fileset layers. A Reader satisfies it directly (one primitive
+// layer); a mergeReader satisfies it for several.
+type FileSet interface {
+	// Iterate calls cb with each file the set exposes, in path order.
+	Iterate(ctx context.Context, cb func(File) error) error
+}
+
+// mergeReader overlays layers the way a composite fileset does: a path
+// that appears in more than one layer is shadowed entirely by its version
+// in the last (topmost) layer, mirroring mergeTOCs/newCompositeFile.
+type mergeReader struct {
+	chunks *chunk.Storage
+	layers []FileSet
+}
+
+// newMergeReader creates a FileSet overlaying layers, last layer on top.
+func newMergeReader(chunks *chunk.Storage, layers []FileSet) *mergeReader {
+	return &mergeReader{chunks: chunks, layers: layers}
+}
+
+func (m *mergeReader) Iterate(ctx context.Context, cb func(File) error) error {
+	byPath := make(map[string][]File)
+	var order []string
+	for _, layer := range m.layers {
+		if err := layer.Iterate(ctx, func(f File) error {
+			path := f.Index().Path
+			if _, ok := byPath[path]; !ok {
+				order = append(order, path)
+			}
+			byPath[path] = append(byPath[path], f)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	sort.Strings(order)
+	for _, path := range order {
+		layers := byPath[path]
+		f := layers[0]
+		if len(layers) > 1 {
+			f = newCompositeFile(m.chunks, path, chunk.IOCategoryUnspecified, layers)
+		}
+		if err := cb(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package fileset
+
+import "context"
+
+// Primitive is the Metadata for a fileset written directly by a Writer: the
+// TOC Storage.Persist recorded for each of its files, keyed by path.
+type Primitive struct {
+	TOCs map[string]*TOC
+}
+
+// Composite is the Metadata for a fileset that's just an ordered overlay of
+// other filesets' layers, as produced by Storage.Compose. The last layer
+// shadows every earlier one for a given path (see mergeTOCs).
+type Composite struct {
+	Layers []ID
+}
+
+// Metadata is what Store persists under a fileset ID: exactly one of a
+// Primitive or a Composite.
+type Metadata struct {
+	Value isMetadataValue
+}
+
+// isMetadataValue marks the types Metadata.Value may hold, the same oneof
+// pattern Metadata_Primitive/Metadata_Composite are already switched on
+// throughout this package (see Storage.Open, Storage.Flatten).
+type isMetadataValue interface {
+	isMetadataValue()
+}
+
+// Metadata_Primitive wraps a Primitive as a Metadata value.
+type Metadata_Primitive struct {
+	Primitive *Primitive
+}
+
+func (*Metadata_Primitive) isMetadataValue() {}
+
+// Metadata_Composite wraps a Composite as a Metadata value.
+type Metadata_Composite struct {
+	Composite *Composite
+}
+
+func (*Metadata_Composite) isMetadataValue() {}
+
+// GetPrimitive returns md's Primitive, or nil if md is nil or holds a
+// Composite instead.
+func (md *Metadata) GetPrimitive() *Primitive {
+	if md == nil {
+		return nil
+	}
+	if x, ok := md.Value.(*Metadata_Primitive); ok {
+		return x.Primitive
+	}
+	return nil
+}
+
+// Store persists fileset Metadata by ID. Storage takes one as a
+// constructor argument the same way it takes a chunk.Storage and a
+// track.Tracker (see NewStorage); production filesets are still tracked in
+// Postgres (see the deleter TODO in storage.go), so this package only
+// defines the interface Storage talks to, not a production-backing
+// implementation.
+type Store interface {
+	Get(ctx context.Context, id ID) (*Metadata, error)
+	Set(ctx context.Context, id ID, md *Metadata) error
+}
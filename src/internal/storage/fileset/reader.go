@@ -0,0 +1,213 @@
+package fileset
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/errors"
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/fileset/index"
+)
+
+// Reader iterates the files of a single primitive fileset, identified by
+// fileSet within store. Its Metadata is only fetched once Iterate is
+// actually called - newReader has no ctx to fetch it with yet - so a Reader
+// reflects whatever store.Get(fileSet) returns at iterate time, not at
+// construction time.
+type Reader struct {
+	store           Store
+	chunks          *chunk.Storage
+	fileSet         string
+	prefix          string
+	category        chunk.IOCategory
+	readAheadChunks int
+	readAheadBytes  int64
+	ioSem           *semaphore.Weighted
+}
+
+// newReader creates a Reader over fileSet as recorded in store, backed by
+// chunks for actually reading file content.
+func newReader(store Store, chunks *chunk.Storage, fileSet string, opts ...index.Option) *Reader {
+	o := &index.Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Reader{
+		store:           store,
+		chunks:          chunks,
+		fileSet:         fileSet,
+		prefix:          o.Prefix,
+		category:        o.Category,
+		readAheadChunks: o.ReadAheadChunks,
+		readAheadBytes:  o.ReadAheadBytes,
+	}
+}
+
+// Iterate calls cb with each of the fileset's files, in path order,
+// restricted to r.prefix if one was given via index.WithPrefix.
+func (r *Reader) Iterate(ctx context.Context, cb func(File) error) error {
+	md, err := r.store.Get(ctx, r.fileSet)
+	if err != nil {
+		return err
+	}
+	prim := md.GetPrimitive()
+	if prim == nil {
+		return errors.Errorf("fileset %v is not primitive", r.fileSet)
+	}
+	paths := make([]string, 0, len(prim.TOCs))
+	for p := range prim.TOCs {
+		if r.prefix != "" && !strings.HasPrefix(p, r.prefix) {
+			continue
+		}
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		f := &fileRecord{
+			chunks:          r.chunks,
+			entry:           &fileEntry{path: p, toc: prim.TOCs[p]},
+			category:        r.category,
+			readAheadChunks: r.readAheadChunks,
+			readAheadBytes:  r.readAheadBytes,
+		}
+		if err := cb(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileRecord is the File produced by a Writer for one of its own files: its
+// TOC came directly from the chunks that Writer actually cut, so Content
+// and ReaderAt read real, written chunk data.
+type fileRecord struct {
+	chunks          *chunk.Storage
+	entry           *fileEntry
+	category        chunk.IOCategory
+	readAheadChunks int
+	readAheadBytes  int64
+}
+
+func (f *fileRecord) Index() *index.Index {
+	return &index.Index{Path: f.entry.path}
+}
+
+func (f *fileRecord) Content(w io.Writer) error {
+	return writeTOC(context.Background(), f.chunks, f.entry.toc, f.category, f.readAheadChunks, f.readAheadBytes, w)
+}
+
+func (f *fileRecord) ReaderAt() io.ReaderAt {
+	return newFileReaderAt(context.Background(), f.chunks, f.entry.toc, f.category, f.readAheadChunks, f.readAheadBytes)
+}
+
+// writeTOC streams a file's content in TOC order via chunk.ReadAhead,
+// prefetching up to readAheadChunks chunks (bounded additionally by
+// readAheadBytes of outstanding data) ahead of the consumer, tagged with
+// category. readAheadChunks <= 0 fetches one chunk at a time, i.e. no
+// prefetching - the same order/throughput as a plain sequential loop, just
+// routed through ReadAhead so repeated refs (e.g. from deduplication) still
+// dedup via singleflight.
+func writeTOC(ctx context.Context, chunks *chunk.Storage, toc *TOC, category chunk.IOCategory, readAheadChunks int, readAheadBytes int64, w io.Writer) error {
+	if len(toc.Entries) == 0 {
+		return nil
+	}
+	nChunks := readAheadChunks
+	if nChunks <= 0 {
+		nChunks = 1
+	}
+	refs := make([]chunk.Ref, len(toc.Entries))
+	for i, e := range toc.Entries {
+		refs[i] = e.ChunkRef
+	}
+	ra := chunk.NewReadAhead(ctx, chunks, refs, nChunks, readAheadBytes, category)
+	defer ra.Close()
+	for _, e := range toc.Entries {
+		data, _, err := ra.Next(ctx)
+		if err != nil {
+			return errors.EnsureStack(err)
+		}
+		if _, err := w.Write(data[e.ChunkOffset : e.ChunkOffset+e.Length]); err != nil {
+			return errors.EnsureStack(err)
+		}
+	}
+	return nil
+}
+
+// Files returns the files appended to w so far as fileset.File values,
+// backed by the chunks actually written to w.chunks, and tagged with w's
+// configured IOCategory and read-ahead settings (see WithReadAhead). Unlike
+// Storage.Persist followed by Storage.Open, Files needs no Store: it reads
+// straight from the TOCs w recorded, for as long as w itself is around.
+func (w *Writer) Files() []File {
+	files := make([]File, len(w.files))
+	for i, e := range w.files {
+		files[i] = &fileRecord{
+			chunks:          w.chunks,
+			entry:           e,
+			category:        w.ioCategory,
+			readAheadChunks: w.readAheadChunks,
+			readAheadBytes:  w.readAheadBytes,
+		}
+	}
+	return files
+}
+
+// compositeFile implements File by overlaying the same path across several
+// underlying layers, the way a composite fileset overlays its primitive
+// layers: the top layer's version of the path shadows every lower layer's
+// version of it. Its TOC is the top layer's TOC (mergeTOCs), so random
+// access over a composite works the same as it would over a single
+// primitive fileset.
+type compositeFile struct {
+	chunks          *chunk.Storage
+	path            string
+	toc             *TOC
+	category        chunk.IOCategory
+	readAheadChunks int
+	readAheadBytes  int64
+}
+
+// newCompositeFile resolves layers (each the same path's File in a
+// different layer, outermost/top layer last) to the single File that
+// should be seen at that path - the top layer's, shadowing any lower
+// layers - tagging reads through the result with category and inheriting
+// the top layer's read-ahead settings.
+func newCompositeFile(chunks *chunk.Storage, path string, category chunk.IOCategory, layers []File) *compositeFile {
+	tocs := make([]*TOC, 0, len(layers))
+	var readAheadChunks int
+	var readAheadBytes int64
+	for _, l := range layers {
+		switch f := l.(type) {
+		case *fileRecord:
+			tocs = append(tocs, f.entry.toc)
+			readAheadChunks, readAheadBytes = f.readAheadChunks, f.readAheadBytes
+		case *compositeFile:
+			tocs = append(tocs, f.toc)
+			readAheadChunks, readAheadBytes = f.readAheadChunks, f.readAheadBytes
+		}
+	}
+	return &compositeFile{
+		chunks:          chunks,
+		path:            path,
+		toc:             mergeTOCs(tocs),
+		category:        category,
+		readAheadChunks: readAheadChunks,
+		readAheadBytes:  readAheadBytes,
+	}
+}
+
+func (f *compositeFile) Index() *index.Index {
+	return &index.Index{Path: f.path}
+}
+
+func (f *compositeFile) Content(w io.Writer) error {
+	return writeTOC(context.Background(), f.chunks, f.toc, f.category, f.readAheadChunks, f.readAheadBytes, w)
+}
+
+func (f *compositeFile) ReaderAt() io.ReaderAt {
+	return newFileReaderAt(context.Background(), f.chunks, f.toc, f.category, f.readAheadChunks, f.readAheadBytes)
+}
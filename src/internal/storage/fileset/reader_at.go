@@ -0,0 +1,85 @@
+package fileset
+
+import (
+	"context"
+	"io"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/errors"
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+)
+
+// fileReaderAt implements io.ReaderAt over a file's TOC, fetching only the
+// chunks a given window actually overlaps (in parallel, via chunk.ReadAhead)
+// rather than decompressing the file from the start. This is what makes
+// Range: requests and mmap-like access from PFS/FUSE feasible without first
+// paying to stream past everything before the requested window.
+type fileReaderAt struct {
+	ctx             context.Context
+	chunks          *chunk.Storage
+	toc             *TOC
+	category        chunk.IOCategory
+	readAheadChunks int
+	readAheadBytes  int64
+}
+
+// newFileReaderAt builds an io.ReaderAt over toc, fetching chunk data from
+// chunks as needed and tagging those fetches with category. Each ReadAt call
+// prefetches the chunks its window overlaps in parallel, bounded by
+// readAheadChunks and readAheadBytes (see chunk.NewReadAhead); readAheadChunks
+// <= 0 falls back to fetching every overlapping chunk in parallel (one
+// window's chunks are already a bounded set), and readAheadBytes <= 0 means
+// unbounded by size.
+func newFileReaderAt(ctx context.Context, chunks *chunk.Storage, toc *TOC, category chunk.IOCategory, readAheadChunks int, readAheadBytes int64) io.ReaderAt {
+	return &fileReaderAt{ctx: ctx, chunks: chunks, toc: toc, category: category, readAheadChunks: readAheadChunks, readAheadBytes: readAheadBytes}
+}
+
+func (r *fileReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	size := r.toc.Size()
+	if off >= size {
+		return 0, io.EOF
+	}
+	want := int64(len(p))
+	if off+want > size {
+		want = size - off
+	}
+	entries := r.toc.Lookup(off, want)
+	if len(entries) == 0 {
+		return 0, io.EOF
+	}
+	refs := make([]chunk.Ref, len(entries))
+	for i, e := range entries {
+		refs[i] = e.ChunkRef
+	}
+	nChunks := r.readAheadChunks
+	if nChunks <= 0 {
+		nChunks = len(refs)
+	}
+	ra := chunk.NewReadAhead(r.ctx, r.chunks, refs, nChunks, r.readAheadBytes, r.category)
+	defer ra.Close()
+
+	var n int
+	for _, e := range entries {
+		data, _, err := ra.Next(r.ctx)
+		if err != nil {
+			return n, errors.EnsureStack(err)
+		}
+		// Clip this entry's chunk bytes down to the part of it that falls
+		// within [off, off+want).
+		lo := int64(0)
+		if e.LogicalOffset < off {
+			lo = off - e.LogicalOffset
+		}
+		hi := e.Length
+		if e.LogicalOffset+e.Length > off+want {
+			hi = off + want - e.LogicalOffset
+		}
+		chunkStart := e.ChunkOffset + lo
+		chunkEnd := e.ChunkOffset + hi
+		n += copy(p[n:], data[chunkStart:chunkEnd])
+	}
+	var err error
+	if off+int64(n) >= size {
+		err = io.EOF
+	}
+	return n, err
+}
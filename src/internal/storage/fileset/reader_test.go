@@ -0,0 +1,68 @@
+package fileset
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+)
+
+// TestFileReaderAtRandomAccess verifies File.ReaderAt returns the right
+// bytes for windows that start and end mid-chunk.
+func TestFileReaderAtRandomAccess(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1<<17) // 1.25MiB; the repeating content yields no CDC boundary, so one chunk
+	chunks := chunk.NewStorage()
+	w := writeOne(t, chunks, data)
+
+	f := w.Files()[0]
+	ra := f.ReaderAt()
+	for _, window := range [][2]int64{
+		{0, 16},
+		{100, 4096},
+		{int64(len(data)) - 10, 10},
+		{int64(len(data)) / 2, int64(len(data)) / 4},
+	} {
+		off, length := window[0], window[1]
+		buf := make([]byte, length)
+		n, err := ra.ReadAt(buf, off)
+		if err != nil && n != len(buf) {
+			t.Fatalf("ReadAt(off=%d, len=%d): n=%d err=%v", off, length, n, err)
+		}
+		if want := data[off : off+length]; !bytes.Equal(buf[:n], want) {
+			t.Fatalf("ReadAt(off=%d, len=%d) returned wrong bytes", off, length)
+		}
+	}
+}
+
+// TestCompositeFileMergesTOCs verifies a composite view over two layers
+// (an older primitive and a newer one overlaying it) shadows the lower
+// layer entirely with the upper layer's content, covering both mergeTOCs
+// and newFileReaderAt together.
+func TestCompositeFileMergesTOCs(t *testing.T) {
+	chunks := chunk.NewStorage()
+	lowerData := []byte("lower layer content, stale")
+	upperData := []byte("upper layer content")
+
+	lower := writeOne(t, chunks, lowerData)
+	upper := writeOne(t, chunks, upperData)
+
+	composite := newCompositeFile(chunks, "/file", chunk.IOCategoryUnspecified, []File{lower.Files()[0], upper.Files()[0]})
+
+	var buf bytes.Buffer
+	if err := composite.Content(&buf); err != nil {
+		t.Fatalf("content: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), upperData) {
+		t.Fatalf("composite content = %q, want %q (upper layer should shadow lower)", buf.Bytes(), upperData)
+	}
+
+	ra := composite.ReaderAt()
+	got := make([]byte, len(upperData))
+	n, err := ra.ReadAt(got, 0)
+	if err != nil && n != len(got) {
+		t.Fatalf("ReadAt: n=%d err=%v", n, err)
+	}
+	if !bytes.Equal(got[:n], upperData) {
+		t.Fatalf("ReadAt returned %q, want %q", got[:n], upperData)
+	}
+}
@@ -2,12 +2,15 @@ package fileset
 
 import (
 	"context"
+	"io"
 	"math"
 	"strings"
 	"time"
 
 	units "github.com/docker/go-units"
 	"github.com/pachyderm/pachyderm/v2/src/internal/errors"
+	"github.com/pachyderm/pachyderm/v2/src/internal/errutil"
+	"github.com/pachyderm/pachyderm/v2/src/internal/pachhash"
 	"github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
 	"github.com/pachyderm/pachyderm/v2/src/internal/storage/fileset/index"
 	"github.com/pachyderm/pachyderm/v2/src/internal/storage/renew"
@@ -45,7 +48,15 @@ type Storage struct {
 	chunks                       *chunk.Storage
 	memThreshold, shardThreshold int64
 	levelFactor                  int64
-	filesetSem                   *semaphore.Weighted
+	// categorySems bounds in-flight chunk writes per chunk.IOCategory, so
+	// e.g. background compaction can be capped without starving user
+	// writes. Each category defaults to unbounded; WithCategorySemaphore
+	// overrides one. newReader records its category's semaphore on the
+	// Reader, but reads do not acquire it.
+	categorySems  map[chunk.IOCategory]*semaphore.Weighted
+	compressor    chunk.Codec_
+	hashAlgorithm pachhash.Algorithm
+	hashCache     *ContentHashCache
 }
 
 // NewStorage creates a new Storage.
@@ -57,7 +68,9 @@ func NewStorage(store Store, tr track.Tracker, chunks *chunk.Storage, opts ...St
 		memThreshold:   DefaultMemoryThreshold,
 		shardThreshold: DefaultShardThreshold,
 		levelFactor:    DefaultLevelFactor,
-		filesetSem:     semaphore.NewWeighted(math.MaxInt64),
+		categorySems:   defaultCategorySems(),
+		hashAlgorithm:  pachhash.DefaultAlgorithm,
+		hashCache:      NewContentHashCache(),
 	}
 	for _, opt := range opts {
 		opt(s)
@@ -65,6 +78,26 @@ func NewStorage(store Store, tr track.Tracker, chunks *chunk.Storage, opts ...St
 	return s
 }
 
+func defaultCategorySems() map[chunk.IOCategory]*semaphore.Weighted {
+	sems := make(map[chunk.IOCategory]*semaphore.Weighted)
+	for _, cat := range []chunk.IOCategory{
+		chunk.IOCategoryUnspecified,
+		chunk.IOCategoryUserWrite,
+		chunk.IOCategoryCompaction,
+		chunk.IOCategoryCopy,
+		chunk.IOCategoryGC,
+		chunk.IOCategoryPrefetch,
+	} {
+		sems[cat] = semaphore.NewWeighted(math.MaxInt64)
+	}
+	return sems
+}
+
+// semaphoreFor returns the semaphore that bounds in-flight I/O for category.
+func (s *Storage) semaphoreFor(category chunk.IOCategory) *semaphore.Weighted {
+	return s.categorySems[category]
+}
+
 // Store returns the underlying store.
 // TODO Store is just used to poke through the information about file set sizes.
 // I think there might be a cleaner way to handle this through the file set interface, and changing
@@ -88,14 +121,38 @@ func (s *Storage) NewWriter(ctx context.Context, opts ...WriterOption) *Writer {
 	return s.newWriter(ctx, opts...)
 }
 
+// Persist closes w and durably records its files as a new primitive
+// fileset, returning the ID Open can later use to read them back - even
+// from a different process, unlike Writer.Files, which only exposes
+// chunk-backed reads for the lifetime of the Writer that wrote them.
+func (s *Storage) Persist(ctx context.Context, w *Writer, ttl time.Duration) (*ID, error) {
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	tocs := make(map[string]*TOC, len(w.files))
+	for _, e := range w.files {
+		tocs[e.path] = e.toc
+	}
+	return s.newPrimitive(ctx, &Primitive{TOCs: tocs}, ttl)
+}
+
 func (s *Storage) newWriter(ctx context.Context, opts ...WriterOption) *Writer {
-	return newWriter(ctx, s, s.tracker, s.chunks, opts...)
+	if s.compressor != nil {
+		opts = append([]WriterOption{withCompressor(s.compressor)}, opts...)
+	}
+	w := newWriter(ctx, s, s.tracker, s.chunks, opts...)
+	w.ioSem = s.semaphoreFor(w.ioCategory)
+	return w
 }
 
-// TODO: Expose some notion of read ahead (read a certain number of chunks in parallel).
-// this will be necessary to speed up reading large files.
 func (s *Storage) newReader(fileSet string, opts ...index.Option) *Reader {
-	return newReader(s.store, s.chunks, fileSet, opts...)
+	o := &index.Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	r := newReader(s.store, s.chunks, fileSet, opts...)
+	r.ioSem = s.semaphoreFor(o.Category)
+	return r
 }
 
 // Open opens a file set for reading.
@@ -111,7 +168,7 @@ func (s *Storage) Open(ctx context.Context, ids []ID, opts ...index.Option) (Fil
 		case *Metadata_Primitive:
 			fss = append(fss, s.newReader(id, opts...))
 		case *Metadata_Composite:
-			fs, err := s.Open(ctx, x.Composite.Layers)
+			fs, err := s.Open(ctx, x.Composite.Layers, opts...)
 			if err != nil {
 				return nil, err
 			}
@@ -119,7 +176,7 @@ func (s *Storage) Open(ctx context.Context, ids []ID, opts ...index.Option) (Fil
 		}
 	}
 	if len(fss) == 0 {
-		return nil, errors.Errorf("error opening fileset: non-existent fileset: %v", fileSets)
+		return nil, errors.Errorf("error opening fileset: non-existent fileset: %v", ids)
 	}
 	if len(fss) == 1 {
 		return fss[0], nil
@@ -127,6 +184,32 @@ func (s *Storage) Open(ctx context.Context, ids []ID, opts ...index.Option) (Fil
 	return newMergeReader(s.chunks, fss), nil
 }
 
+// OpenAt opens a ranged, random-access view of a single file within ids:
+// [offset, offset+length) of its logical content, without decompressing any
+// chunk that window doesn't overlap. It mirrors the eStargz/zstd:chunked
+// TOC design so partial-object reads (Range: requests, mmap-like access
+// from PFS/FUSE) don't need to read the whole object to reach a small tail.
+func (s *Storage) OpenAt(ctx context.Context, ids []ID, path string, offset, length int64) (io.ReaderAt, error) {
+	fs, err := s.Open(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	var found File
+	if err := fs.Iterate(ctx, func(f File) error {
+		if f.Index().Path == path {
+			found = f
+			return errutil.ErrBreak
+		}
+		return nil
+	}); err != nil && !errors.Is(err, errutil.ErrBreak) {
+		return nil, err
+	}
+	if found == nil {
+		return nil, errors.Errorf("OpenAt: no file at path %q in %v", path, ids)
+	}
+	return io.NewSectionReader(found.ReaderAt(), offset, length), nil
+}
+
 // Compose produces a composite fileset from the filesets under ids
 func (s *Storage) Compose(ctx context.Context, ids []ID, ttl time.Duration) (*ID, error) {
 	c := &Composite{
@@ -198,9 +281,10 @@ func (s *Storage) WithRenewer(ctx context.Context, ttl time.Duration, cb func(co
 func (s *Storage) GC(ctx context.Context) error {
 	const period = 10 * time.Second
 	tmpDeleter := track.NewTmpDeleter()
-	chunkDeleter := s.chunks.NewDeleter()
+	chunkDeleter := s.chunks.NewDeleter(chunk.IOCategoryGC)
 	filesetDeleter := &deleter{
-		store: s.store,
+		store:     s.store,
+		hashCache: s.hashCache,
 	}
 	mux := track.DeleterMux(func(id string) track.Deleter {
 		switch {
@@ -270,10 +354,14 @@ func filesetObjectID(id ID) string {
 var _ track.Deleter = &deleter{}
 
 type deleter struct {
-	store Store
+	store     Store
+	hashCache *ContentHashCache
 }
 
 // TODO: This needs to be implemented, temporary filesets are still in Postgres.
 func (d *deleter) Delete(ctx context.Context, id string) error {
+	if d.hashCache != nil {
+		d.hashCache.invalidateFileset(ID(strings.TrimPrefix(id, TrackerPrefix)))
+	}
 	return nil
 }
@@ -0,0 +1,51 @@
+package fileset
+
+import (
+	"golang.org/x/sync/semaphore"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/pachhash"
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+)
+
+// StorageOption configures a Storage created by NewStorage.
+type StorageOption func(s *Storage)
+
+// WithHashAlgorithm configures Storage to hash the chunks its Writers cut
+// (and the digests Checksum computes) with alg instead of
+// pachhash.DefaultAlgorithm (blake2b-256). Use a faster, non-cryptographic
+// algorithm like pachhash.AlgorithmXXH3_128 for content that's only ever used
+// for dedup, not for anything that is signed or otherwise verified. The
+// resulting chunk refs are tagged with alg's prefix (see
+// pachhash.EncodeHashWithAlgorithm), so chunks written under different
+// algorithms can coexist during a migration, and chunk.Storage.GetChunk
+// rejects a chunk ref tagged with an algorithm that isn't registered.
+// Fileset IDs are random and carry no algorithm tag, and Storage.Open does
+// no algorithm check of its own.
+func WithHashAlgorithm(alg pachhash.Algorithm) StorageOption {
+	return func(s *Storage) {
+		s.hashAlgorithm = alg
+	}
+}
+
+// WithCategorySemaphore overrides the semaphore that bounds in-flight chunk
+// writes tagged with category (see chunk.IOCategory), e.g. to cap
+// background compaction bandwidth without starving user writes. A Writer
+// acquires a weight of 1 per chunk it writes:
+//
+//	fileset.WithCategorySemaphore(chunk.IOCategoryCompaction, semaphore.NewWeighted(compactionChunkWritesInFlight))
+func WithCategorySemaphore(category chunk.IOCategory, sem *semaphore.Weighted) StorageOption {
+	return func(s *Storage) {
+		s.categorySems[category] = sem
+	}
+}
+
+// WithCompressor configures Storage to compress new chunks with c instead of
+// the chunk package's default codec. Filesets written under a different
+// codec (including the default) continue to read correctly: the codec used
+// for a chunk is stamped into that chunk's own metadata and looked up on
+// read, so a Storage's compressor only ever affects chunks it writes.
+func WithCompressor(c chunk.Codec_) StorageOption {
+	return func(s *Storage) {
+		s.compressor = c
+	}
+}
@@ -0,0 +1,182 @@
+package fileset
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/errors"
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+)
+
+// memStore is a Store backed by an in-memory map, standing in for the
+// Postgres-backed implementation production Storages use (see the deleter
+// TODO in storage.go), so tests can exercise a real Storage.Persist/Open round
+// trip without one.
+type memStore struct {
+	mu  sync.Mutex
+	mds map[ID]*Metadata
+}
+
+func newMemStore() *memStore {
+	return &memStore{mds: make(map[ID]*Metadata)}
+}
+
+func (m *memStore) Get(ctx context.Context, id ID) (*Metadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	md, ok := m.mds[id]
+	if !ok {
+		return nil, errors.Errorf("memStore: no such fileset %v", id)
+	}
+	return md, nil
+}
+
+func (m *memStore) Set(ctx context.Context, id ID, md *Metadata) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mds[id] = md
+	return nil
+}
+
+// TestStoragePersistOpenRoundTrip verifies a Writer's files survive a real
+// Persist -> Open round trip through a Store, not just the direct
+// Writer.Files access the rest of this package's tests use - the path the
+// fileset package previously had no test, or production code path, for.
+func TestStoragePersistOpenRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	chunks := chunk.NewStorage()
+	store := newMemStore()
+	storage := NewStorage(store, nil, chunks)
+
+	data := []byte("round trip me")
+	w := storage.NewWriter(ctx)
+	if err := w.Append("/file", func(fw *FileWriter) error {
+		_, err := fw.Write(data)
+		return err
+	}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	id, err := storage.Persist(ctx, w, time.Hour)
+	if err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+
+	fs, err := storage.Open(ctx, []ID{*id})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	var got []byte
+	var path string
+	if err := fs.Iterate(ctx, func(f File) error {
+		path = f.Index().Path
+		var buf bytes.Buffer
+		if err := f.Content(&buf); err != nil {
+			return err
+		}
+		got = buf.Bytes()
+		return nil
+	}); err != nil {
+		t.Fatalf("iterate: %v", err)
+	}
+	if path != "/file" {
+		t.Fatalf("path = %q, want /file", path)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("content = %q, want %q", got, data)
+	}
+}
+
+// TestStorageComposeOverlaysLayers verifies Storage.Open over a composite
+// fileset's Metadata (the kind Storage.Compose records) exercises the real
+// composite overlay path (mergeReader/newCompositeFile) end to end: a later
+// layer's file shadows an earlier layer's file at the same
+// path, and an untouched path from the earlier layer still reads through.
+func TestStorageComposeOverlaysLayers(t *testing.T) {
+	ctx := context.Background()
+	chunks := chunk.NewStorage()
+	store := newMemStore()
+	storage := NewStorage(store, nil, chunks)
+
+	persist := func(path string, data []byte) ID {
+		t.Helper()
+		w := storage.NewWriter(ctx)
+		if err := w.Append(path, func(fw *FileWriter) error {
+			_, err := fw.Write(data)
+			return err
+		}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		id, err := storage.Persist(ctx, w, time.Hour)
+		if err != nil {
+			t.Fatalf("persist: %v", err)
+		}
+		return *id
+	}
+
+	lower := persist("/shared", []byte("stale"))
+	upperID := func() ID {
+		w := storage.NewWriter(ctx)
+		if err := w.Append("/shared", func(fw *FileWriter) error {
+			_, err := fw.Write([]byte("fresh"))
+			return err
+		}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		if err := w.Append("/only-in-upper", func(fw *FileWriter) error {
+			_, err := fw.Write([]byte("new"))
+			return err
+		}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		id, err := storage.Persist(ctx, w, time.Hour)
+		if err != nil {
+			t.Fatalf("persist: %v", err)
+		}
+		return *id
+	}()
+
+	untouched := persist("/only-in-lower", []byte("original"))
+
+	// Stored directly rather than via Storage.Compose: Compose's
+	// newComposite registers the composite with s.tracker, and this
+	// package's tests have no working track.Tracker to give it (every
+	// existing Writer-level test passes nil for the same reason). Storing
+	// the Metadata_Composite by hand still exercises the real thing this
+	// test cares about: Open resolving a composite via mergeReader and
+	// newCompositeFile.
+	compositeID := newID()
+	if err := store.Set(ctx, compositeID, &Metadata{
+		Value: &Metadata_Composite{Composite: &Composite{Layers: []ID{lower, untouched, upperID}}},
+	}); err != nil {
+		t.Fatalf("set composite: %v", err)
+	}
+
+	fs, err := storage.Open(ctx, []ID{compositeID})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	contents := make(map[string]string)
+	if err := fs.Iterate(ctx, func(f File) error {
+		var buf bytes.Buffer
+		if err := f.Content(&buf); err != nil {
+			return err
+		}
+		contents[f.Index().Path] = buf.String()
+		return nil
+	}); err != nil {
+		t.Fatalf("iterate: %v", err)
+	}
+
+	if got, want := contents["/shared"], "fresh"; got != want {
+		t.Fatalf("/shared = %q, want %q (upper layer should shadow lower)", got, want)
+	}
+	if got, want := contents["/only-in-upper"], "new"; got != want {
+		t.Fatalf("/only-in-upper = %q, want %q", got, want)
+	}
+	if got, want := contents["/only-in-lower"], "original"; got != want {
+		t.Fatalf("/only-in-lower = %q, want %q", got, want)
+	}
+}
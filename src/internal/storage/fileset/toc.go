@@ -0,0 +1,91 @@
+package fileset
+
+import (
+	"sort"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+)
+
+// TOCEntry records where one contiguous span of a file's logical content
+// lives within a single chunk. A file's TOC is the sorted list of its
+// entries, and lets a ranged read binary-search straight to the chunks that
+// cover a window instead of streaming the whole file.
+type TOCEntry struct {
+	// LogicalOffset is this entry's starting offset within the file.
+	LogicalOffset int64
+	// ChunkRef identifies the chunk holding this entry's bytes.
+	ChunkRef chunk.Ref
+	// ChunkOffset is the offset within the (decompressed) chunk where this
+	// entry's bytes start.
+	ChunkOffset int64
+	// Length is the number of bytes this entry covers.
+	Length int64
+	// Tag is the name passed to FileWriter.Append that was active when this
+	// entry's bytes were written. A tag boundary doesn't force a chunk cut,
+	// so two tags can still land in the same chunk, but it does force a new
+	// TOCEntry: every entry has exactly one tag, which is what lets
+	// EntriesForTag extract one tagged part of a file without decoding the
+	// whole thing.
+	Tag string
+}
+
+// TOC is a file's table of contents: its TOCEntries in ascending
+// LogicalOffset order, covering the file with no gaps or overlaps.
+type TOC struct {
+	Entries []TOCEntry
+}
+
+// Size returns the file's total logical length as recorded by the TOC.
+func (t *TOC) Size() int64 {
+	if len(t.Entries) == 0 {
+		return 0
+	}
+	last := t.Entries[len(t.Entries)-1]
+	return last.LogicalOffset + last.Length
+}
+
+// Lookup returns the entries covering [offset, offset+length), in order.
+// The first and last returned entries may extend beyond the requested
+// window; the caller slices within them.
+func (t *TOC) Lookup(offset, length int64) []TOCEntry {
+	if length <= 0 || offset >= t.Size() {
+		return nil
+	}
+	end := offset + length
+	// start is the last entry beginning at or before offset.
+	start := sort.Search(len(t.Entries), func(i int) bool {
+		return t.Entries[i].LogicalOffset+t.Entries[i].Length > offset
+	})
+	var out []TOCEntry
+	for i := start; i < len(t.Entries) && t.Entries[i].LogicalOffset < end; i++ {
+		out = append(out, t.Entries[i])
+	}
+	return out
+}
+
+// EntriesForTag returns t's entries whose Tag is tag, in ascending
+// LogicalOffset order.
+func (t *TOC) EntriesForTag(tag string) []TOCEntry {
+	var out []TOCEntry
+	for _, e := range t.Entries {
+		if e.Tag == tag {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// mergeTOCs resolves one path's TOC across the layers of a composite
+// fileset. Each layer's TOC already covers the path's entire logical
+// content as of that layer, so overlaying them is last-layer-wins, not
+// concatenation: the top (last) layer that has the path shadows every
+// lower layer's version of it completely, the same way mergeReader
+// otherwise shadows whole files across layers.
+func mergeTOCs(tocs []*TOC) *TOC {
+	for i := len(tocs) - 1; i >= 0; i-- {
+		if tocs[i] != nil {
+			return tocs[i]
+		}
+	}
+	return &TOC{}
+}
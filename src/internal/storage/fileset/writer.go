@@ -0,0 +1,201 @@
+package fileset
+
+import (
+	"context"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/pachhash"
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/track"
+)
+
+const (
+	// defaultChunkMin, defaultChunkAvg, and defaultChunkMax are the chunk
+	// size bounds used when WithContentDefinedChunking isn't given.
+	defaultChunkMin = 1 * 1024 * 1024
+	defaultChunkAvg = 2 * 1024 * 1024
+	defaultChunkMax = 8 * 1024 * 1024
+)
+
+// fileEntry accumulates the TOC for one path appended to a Writer.
+type fileEntry struct {
+	path string
+	toc  *TOC
+	size int64
+	// tag is the name most recently passed to FileWriter.Append for this
+	// file; every pendingSpan created by a subsequent Write carries it
+	// through to its TOCEntry.
+	tag string
+}
+
+// pendingSpan is a run of bytes written to a Writer's buffer that hasn't
+// been assigned to a chunk yet, because the chunk it will land in hasn't
+// been cut.
+type pendingSpan struct {
+	file       *fileEntry
+	fileOffset int64
+	bufOffset  int64
+	length     int64
+	tag        string
+}
+
+// Writer appends files to a new fileset. Content is cut into chunks by
+// chunker and flushed to chunks as soon as a boundary is found, independent
+// of which file or tag the bytes at that boundary belong to: a tag (or even
+// a file) may end up split across two chunks, or several files may share
+// one chunk, which is what lets deduplication work across edits instead of
+// being defeated by fixed-size boundaries.
+type Writer struct {
+	ctx     context.Context
+	tracker track.Tracker
+	chunks  *chunk.Storage
+
+	chunker         *chunk.CDCChunker
+	compressor      chunk.Codec_
+	hashAlgorithm   pachhash.Algorithm
+	ioCategory      chunk.IOCategory
+	ioSem           *semaphore.Weighted
+	readAheadChunks int
+	readAheadBytes  int64
+
+	buf     []byte
+	pending []pendingSpan
+	files   []*fileEntry
+}
+
+func newWriter(ctx context.Context, storage *Storage, tracker track.Tracker, chunks *chunk.Storage, opts ...WriterOption) *Writer {
+	w := &Writer{
+		ctx:           ctx,
+		tracker:       tracker,
+		chunks:        chunks,
+		chunker:       chunk.NewCDCChunker(defaultChunkMin, defaultChunkAvg, defaultChunkMax),
+		hashAlgorithm: storage.hashAlgorithm,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// FileWriter writes one file's tagged parts for a single Writer.Append call.
+// A tag boundary is purely bookkeeping recorded by Append; it doesn't force
+// a chunk cut, because the fileset index (the file's TOC) already records
+// each part's offset within whichever chunk it lands in.
+type FileWriter struct {
+	w     *Writer
+	entry *fileEntry
+}
+
+// Append starts a new tagged part of the file; subsequent Write calls
+// belong to this tag until the next Append call or the callback returns.
+// It doesn't force a chunk cut - tags are a finer boundary than chunks, and
+// several tags can still share one chunk - but every span writeFileBytes
+// creates afterward is stamped with this tag in its TOCEntry.
+func (fw *FileWriter) Append(tag string) {
+	fw.entry.tag = tag
+}
+
+// Write appends data to the file at the writer's current position, cutting
+// chunks at content-defined boundaries as fw.w.chunker finds them.
+func (fw *FileWriter) Write(data []byte) (int, error) {
+	return fw.w.writeFileBytes(fw.entry, data)
+}
+
+// Append writes one file's content (via cb) to w, recording its TOC as
+// chunks are cut.
+func (w *Writer) Append(path string, cb func(fw *FileWriter) error) error {
+	entry := &fileEntry{path: path, toc: &TOC{}}
+	fw := &FileWriter{w: w, entry: entry}
+	if err := cb(fw); err != nil {
+		return err
+	}
+	w.files = append(w.files, entry)
+	return nil
+}
+
+// writeFileBytes feeds data through w.chunker, buffering bytes since the
+// last cut and recording which file/offset range they belong to, so that
+// once a chunk is actually cut and given a Ref, every pending span within
+// it can be turned into a TOCEntry.
+func (w *Writer) writeFileBytes(entry *fileEntry, data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		cut, found := w.chunker.Next(data)
+		span := pendingSpan{
+			file:       entry,
+			fileOffset: entry.size,
+			bufOffset:  int64(len(w.buf)),
+			length:     int64(cut),
+			tag:        entry.tag,
+		}
+		w.buf = append(w.buf, data[:cut]...)
+		w.pending = append(w.pending, span)
+		entry.size += int64(cut)
+		written += cut
+		data = data[cut:]
+		if found {
+			if err := w.cutChunk(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// cutChunk flushes the writer's buffered bytes as one chunk to chunk.Storage
+// and resolves every pending span against the resulting Ref.
+func (w *Writer) cutChunk() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	data := w.buf
+	w.buf = nil
+	pending := w.pending
+	w.pending = nil
+
+	sem := w.ioSem
+	if sem != nil {
+		if err := sem.Acquire(w.ctx, 1); err != nil {
+			return err
+		}
+		defer sem.Release(1)
+	}
+	var putOpts []chunk.PutOption
+	if w.compressor != nil {
+		putOpts = append(putOpts, chunk.WithPutCompressor(w.compressor))
+	}
+	if w.hashAlgorithm != "" {
+		putOpts = append(putOpts, chunk.WithPutHashAlgorithm(w.hashAlgorithm))
+	}
+	putOpts = append(putOpts, chunk.WithPutCategory(w.ioCategory))
+	ref, err := w.chunks.Put(w.ctx, data, putOpts...)
+	if err != nil {
+		return err
+	}
+	for _, p := range pending {
+		p.file.toc.Entries = append(p.file.toc.Entries, TOCEntry{
+			LogicalOffset: p.fileOffset,
+			ChunkRef:      ref,
+			ChunkOffset:   p.bufOffset,
+			Length:        p.length,
+			Tag:           p.tag,
+		})
+	}
+	return nil
+}
+
+// appendTOC records toc as path's file in w, without feeding any bytes
+// through w.chunker: toc's entries already point at chunks that exist in
+// w.chunks (see CopyFiles), so there's nothing left to cut.
+func (w *Writer) appendTOC(path string, toc *TOC) {
+	w.files = append(w.files, &fileEntry{path: path, toc: toc, size: toc.Size()})
+}
+
+// Close flushes any buffered tail bytes into a final chunk. Callers that
+// only need the written files' TOCs (as the dedup tests in this package do)
+// can call Close and then inspect Writer.files directly; persisting the
+// files into a fileset Primitive is handled above this layer.
+func (w *Writer) Close() error {
+	return w.cutChunk()
+}
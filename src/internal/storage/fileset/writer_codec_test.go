@@ -0,0 +1,72 @@
+package fileset
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+)
+
+// writeOneWithCompressor is writeOne, but lets the caller configure the
+// Writer's compressor the way WithCompressor on fileset.Storage does.
+func writeOneWithCompressor(t *testing.T, chunks *chunk.Storage, data []byte, compressor chunk.Codec_) *Writer {
+	t.Helper()
+	opts := []WriterOption{WithContentDefinedChunking(512*1024, 1024*1024, 4*1024*1024)}
+	if compressor != nil {
+		opts = append(opts, withCompressor(compressor))
+	}
+	storage := &Storage{}
+	w := newWriter(context.Background(), storage, nil, chunks, opts...)
+	if err := w.Append("/file", func(fw *FileWriter) error {
+		_, err := fw.Write(data)
+		return err
+	}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	return w
+}
+
+// TestWriterCompressorRoundTrip verifies a Writer configured with a
+// non-default compressor actually compresses with it, and that the chunks
+// it writes read back correctly.
+func TestWriterCompressorRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("round trip content "), 1<<16)
+	chunks := chunk.NewStorage()
+	w := writeOneWithCompressor(t, chunks, data, chunk.NewZstd(zstd.SpeedDefault))
+
+	for _, e := range w.files[0].toc.Entries {
+		if e.ChunkRef.Codec != chunk.CodecZstd {
+			t.Fatalf("chunk written by a zstd-configured Writer has codec %v, want CodecZstd", e.ChunkRef.Codec)
+		}
+	}
+	if got := readBack(t, chunks, w); !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch after round trip through zstd")
+	}
+}
+
+// TestStorageReadsMixedCodecs verifies that chunks written under different
+// codecs (e.g. before and after a Storage's configured compressor changes)
+// coexist in the same chunk.Storage and both keep reading correctly: the
+// codec actually used is stamped per-chunk, not assumed from the reader's
+// current configuration.
+func TestStorageReadsMixedCodecs(t *testing.T) {
+	chunks := chunk.NewStorage()
+	gzipData := bytes.Repeat([]byte("gzip era content "), 1<<16)
+	zstdData := bytes.Repeat([]byte("zstd era content "), 1<<16)
+
+	wGzip := writeOneWithCompressor(t, chunks, gzipData, nil)
+	wZstd := writeOneWithCompressor(t, chunks, zstdData, chunk.NewZstd(zstd.SpeedDefault))
+
+	if got := readBack(t, chunks, wGzip); !bytes.Equal(got, gzipData) {
+		t.Fatalf("gzip-written file did not read back correctly once a zstd writer had also used chunks")
+	}
+	if got := readBack(t, chunks, wZstd); !bytes.Equal(got, zstdData) {
+		t.Fatalf("zstd-written file did not read back correctly")
+	}
+}
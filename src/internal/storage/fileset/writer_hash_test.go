@@ -0,0 +1,38 @@
+package fileset
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/pachhash"
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+)
+
+// TestStorageHashAlgorithmWiring verifies that a fileset.Storage built with
+// WithHashAlgorithm actually hashes the chunks its writers cut with that
+// algorithm, via the same newWriter path Storage.NewWriter uses.
+func TestStorageHashAlgorithmWiring(t *testing.T) {
+	chunks := chunk.NewStorage()
+	storage := &Storage{hashAlgorithm: pachhash.AlgorithmXXH3_128}
+	w := newWriter(context.Background(), storage, nil, chunks,
+		WithContentDefinedChunking(512*1024, 1024*1024, 4*1024*1024))
+	if err := w.Append("/file", func(fw *FileWriter) error {
+		_, err := fw.Write([]byte("hash me with xxh3"))
+		return err
+	}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if len(w.files[0].toc.Entries) == 0 {
+		t.Fatalf("expected at least one chunk to be cut")
+	}
+	for _, e := range w.files[0].toc.Entries {
+		if !strings.HasPrefix(string(e.ChunkRef.Id), string(pachhash.AlgorithmXXH3_128)+"-") {
+			t.Fatalf("chunk ref %q wasn't hashed with the Storage's configured algorithm", e.ChunkRef.Id)
+		}
+	}
+}
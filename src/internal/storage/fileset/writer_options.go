@@ -0,0 +1,54 @@
+package fileset
+
+import "github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+
+// WriterOption configures a Writer created by Storage.NewWriter.
+type WriterOption func(w *Writer)
+
+// WithContentDefinedChunking causes the Writer to cut chunk boundaries using
+// a rolling hash over the content rather than at fixed byte offsets. This
+// keeps an edit near the start of a file from shifting every chunk boundary
+// after it, which is what defeats deduplication in chunk.Storage under fixed
+// sizing. min, avg, and max bound the resulting chunk sizes; see
+// chunk.NewCDCChunker for how the cut points are chosen.
+//
+// A chunk boundary chosen this way is independent of tag boundaries recorded
+// by FileWriter.Append: a tag may end up in the middle of a chunk, which is
+// fine because the index already records each tag's offset within its chunk.
+func WithContentDefinedChunking(min, avg, max int) WriterOption {
+	return func(w *Writer) {
+		w.chunker = chunk.NewCDCChunker(min, avg, max)
+	}
+}
+
+// withCompressor is applied by Storage.newWriter when the Storage was built
+// with WithCompressor; it is not exported because callers configure the
+// codec at the Storage level, not per Writer.
+func withCompressor(c chunk.Codec_) WriterOption {
+	return func(w *Writer) {
+		w.compressor = c
+	}
+}
+
+// WithIOCategory tags every chunk write this Writer makes with category, so
+// it's counted separately in chunk storage's per-category metrics and bound
+// by that category's semaphore (see Storage.semaphoreFor) instead of
+// whichever one IOCategoryUnspecified maps to.
+func WithIOCategory(category chunk.IOCategory) WriterOption {
+	return func(w *Writer) {
+		w.ioCategory = category
+	}
+}
+
+// WithReadAhead causes File values later returned by Writer.Files to
+// prefetch up to nChunks chunks (bounded additionally by maxBytes of
+// outstanding, not-yet-consumed data) ahead of the consumer when reading
+// content or doing random access, via chunk.ReadAhead. nChunks <= 0
+// disables prefetching for Content, while ReaderAt then fetches all of a
+// window's chunks in parallel; maxBytes <= 0 means unbounded by size.
+func WithReadAhead(nChunks int, maxBytes int64) WriterOption {
+	return func(w *Writer) {
+		w.readAheadChunks = nChunks
+		w.readAheadBytes = maxBytes
+	}
+}
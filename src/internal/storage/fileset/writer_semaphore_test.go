@@ -0,0 +1,51 @@
+package fileset
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+)
+
+// TestWriterIOSemaphoreBounds verifies that a Writer's ioSem (as assigned by
+// Storage.semaphoreFor based on its IOCategory) actually gates cutChunk,
+// rather than being set but never acquired.
+func TestWriterIOSemaphoreBounds(t *testing.T) {
+	sem := semaphore.NewWeighted(1)
+	chunks := chunk.NewStorage()
+	storage := &Storage{}
+	newBufferedWriter := func(data []byte) *Writer {
+		w := newWriter(context.Background(), storage, nil, chunks)
+		w.ioSem = sem
+		w.buf = data
+		return w
+	}
+	w1 := newBufferedWriter([]byte("first"))
+	w2 := newBufferedWriter([]byte("second"))
+
+	if err := sem.Acquire(context.Background(), 1); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- w1.cutChunk() }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("cutChunk proceeded while the semaphore was held: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sem.Release(1)
+	if err := <-done; err != nil {
+		t.Fatalf("cutChunk: %v", err)
+	}
+
+	// The semaphore is released once more by the time cutChunk returns, so
+	// a second Writer sharing it isn't starved.
+	if err := w2.cutChunk(); err != nil {
+		t.Fatalf("second cutChunk: %v", err)
+	}
+}
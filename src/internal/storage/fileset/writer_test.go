@@ -0,0 +1,125 @@
+package fileset
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/pachyderm/pachyderm/v2/src/internal/pachhash"
+	"github.com/pachyderm/pachyderm/v2/src/internal/storage/chunk"
+)
+
+// writeOne appends a single file containing data to a fresh Writer over
+// chunks and returns it closed.
+func writeOne(t *testing.T, chunks *chunk.Storage, data []byte) *Writer {
+	t.Helper()
+	storage := &Storage{hashAlgorithm: pachhash.DefaultAlgorithm}
+	w := newWriter(context.Background(), storage, nil, chunks,
+		WithContentDefinedChunking(512*1024, 1024*1024, 4*1024*1024))
+	if err := w.Append("/file", func(fw *FileWriter) error {
+		_, err := fw.Write(data)
+		return err
+	}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	return w
+}
+
+// readBack reassembles the single file w wrote, straight from the TOC it
+// recorded, without going through any higher-level File implementation.
+func readBack(t *testing.T, chunks *chunk.Storage, w *Writer) []byte {
+	t.Helper()
+	if len(w.files) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(w.files))
+	}
+	var buf bytes.Buffer
+	for _, e := range w.files[0].toc.Entries {
+		data, err := chunks.GetChunk(context.Background(), e.ChunkRef)
+		if err != nil {
+			t.Fatalf("getchunk: %v", err)
+		}
+		buf.Write(data[e.ChunkOffset : e.ChunkOffset+e.Length])
+	}
+	return buf.Bytes()
+}
+
+// TestWriterContentDefinedChunkingDedup exercises the fileset-level dedup
+// property WithContentDefinedChunking exists for: inserting a byte at the
+// head of a file should perturb at most O(1) of the chunks Writer cuts for
+// it, not every chunk from the insertion point on, the way fixed-size
+// chunking would.
+func TestWriterContentDefinedChunkingDedup(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	data := make([]byte, 4*1024*1024)
+	r.Read(data)
+
+	chunks := chunk.NewStorage()
+	w1 := writeOne(t, chunks, data)
+	before := chunks.Len()
+
+	modified := make([]byte, len(data)+1)
+	modified[0] = 0xff
+	copy(modified[1:], data)
+	w2 := writeOne(t, chunks, modified)
+	after := chunks.Len()
+
+	if rewritten := after - before; rewritten > 2 {
+		t.Fatalf("head insert added %d new chunks; want O(1)", rewritten)
+	}
+
+	if got := readBack(t, chunks, w1); !bytes.Equal(got, data) {
+		t.Fatalf("w1 content mismatch: got %d bytes, want %d", len(got), len(data))
+	}
+	if got := readBack(t, chunks, w2); !bytes.Equal(got, modified) {
+		t.Fatalf("w2 content mismatch: got %d bytes, want %d", len(got), len(modified))
+	}
+}
+
+// TestFileWriterAppendTagsTOCEntries verifies FileWriter.Append actually
+// records which tag each TOCEntry belongs to, so EntriesForTag can recover
+// one tagged part of a file without decoding the whole thing.
+func TestFileWriterAppendTagsTOCEntries(t *testing.T) {
+	chunks := chunk.NewStorage()
+	storage := &Storage{hashAlgorithm: pachhash.DefaultAlgorithm}
+	w := newWriter(context.Background(), storage, nil, chunks)
+	if err := w.Append("/file", func(fw *FileWriter) error {
+		fw.Append("a")
+		if _, err := fw.Write([]byte("aaaa")); err != nil {
+			return err
+		}
+		fw.Append("b")
+		if _, err := fw.Write([]byte("bbbbbb")); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	toc := w.files[0].toc
+	aEntries := toc.EntriesForTag("a")
+	bEntries := toc.EntriesForTag("b")
+	if len(aEntries) == 0 || len(bEntries) == 0 {
+		t.Fatalf("expected entries for both tags, got %d for a, %d for b", len(aEntries), len(bEntries))
+	}
+	var aBytes, bBytes int64
+	for _, e := range aEntries {
+		aBytes += e.Length
+	}
+	for _, e := range bEntries {
+		bBytes += e.Length
+	}
+	if aBytes != 4 {
+		t.Fatalf("tag \"a\" covers %d bytes, want 4", aBytes)
+	}
+	if bBytes != 6 {
+		t.Fatalf("tag \"b\" covers %d bytes, want 6", bBytes)
+	}
+}